@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Citizens may react to the risk they perceive by giving up part of their contacts: the more
+// of their neighbours (within MaximumTravelRange) are visibly ill, and the more deaths were
+// reported lately, the fewer people they meet; both sides of a contact react, the infectious
+// citizen and the one they would meet. The reaction wanes with fatigue: every day someone is
+// visibly ill, the citizens lose a share of their vigilance, which scales down their reaction
+// from then on. Contacts fall as a wave builds up and come back as it wanes, or as the
+// citizens tire of it.
+
+const defaultDeathsWindow = 14
+
+type adaptiveBehaviourSpecification struct {
+	LocalResponse   float64 // share of the contacts given up per share of visibly ill neighbours, 2 to halve them when a quarter of the neighbours are ill
+	DeathsResponse  float64 // share of the contacts given up per death reported over DeathsWindow, per 1000 citizens
+	DeathsWindow    int     // days of reported deaths the citizens react to, 14 when omitted
+	MinimumContacts float64 // share of their contacts the citizens keep whatever happens, 0-1
+	Fatigue         float64 // % of their vigilance the citizens lose every day someone is visibly ill
+}
+
+func compileAdaptiveBehaviour(specification *adaptiveBehaviourSpecification) (*adaptiveBehaviourSpecification, error) {
+	if specification == nil {
+		return nil, nil
+	}
+	model := *specification
+	if model.DeathsWindow == 0 {
+		model.DeathsWindow = defaultDeathsWindow
+	}
+	switch {
+	case model.LocalResponse < 0 || model.DeathsResponse < 0:
+		return nil, fmt.Errorf("adaptive behaviour: negative response")
+	case model.DeathsWindow < 0:
+		return nil, fmt.Errorf("adaptive behaviour: negative deaths window")
+	case model.MinimumContacts < 0 || model.MinimumContacts > 1:
+		return nil, fmt.Errorf("adaptive behaviour: minimum contacts out of 0-1")
+	case model.Fatigue < 0 || model.Fatigue > 100:
+		return nil, fmt.Errorf("adaptive behaviour: fatigue out of 0-100")
+	}
+	return &model, nil
+}
+
+// visiblyIll tells whether the neighbours can see the citizen is sick
+func (state State) visiblyIll() bool {
+	return state == StateIll || state == StateUnderTreatment || state == StateICU
+}
+
+// updateVigilance takes stock of the deaths reported lately and of the citizens' fatigue
+// at the start of a day, from the days before
+func (s *simulation) updateVigilance() {
+	if s.adaptive == nil {
+		return
+	}
+	earlier := s.history[int(math.Max(0, float64(len(s.history)-1-s.adaptive.DeathsWindow)))]
+	s.globalStats.reportedDeaths = float64(s.globalStats.totalDead-earlier.totalDead) * 1000 / float64(s.parameters.TotalPopulation)
+
+	if s.globalStats.totalIll+s.globalStats.totalHospitalized+s.globalStats.totalICU > 0 {
+		s.globalStats.fatigue += (1 - s.globalStats.fatigue) * s.adaptive.Fatigue / 100
+	}
+	s.countIllAround()
+}
+
+// countIllAround counts the visibly ill neighbours of every cell, within MaximumTravelRange and
+// across the edges of the grid as the contacts go, summing along the rows then along the columns
+func (s *simulation) countIllAround() {
+	p := s.population
+	dimension, radius := p.dimension, s.parameters.MaximumTravelRange
+	wrap := func(i int) int { return ((i % dimension) + dimension) % dimension }
+
+	rows := make([]int32, p.size())
+	for i := 0; i < dimension; i++ {
+		ill := func(j int) int32 {
+			if p.state[i*dimension+wrap(j)].visiblyIll() {
+				return 1
+			}
+			return 0
+		}
+		sum := int32(0)
+		for offset := -radius; offset <= radius; offset++ {
+			sum += ill(offset)
+		}
+		for j := 0; j < dimension; j++ {
+			rows[i*dimension+j] = sum
+			sum += ill(j+radius+1) - ill(j-radius)
+		}
+	}
+
+	if s.illAround == nil {
+		s.illAround = make([]int32, p.size())
+	}
+	for j := 0; j < dimension; j++ {
+		sum := int32(0)
+		for offset := -radius; offset <= radius; offset++ {
+			sum += rows[wrap(offset)*dimension+j]
+		}
+		for i := 0; i < dimension; i++ {
+			// the citizen is not a neighbour of theirs
+			s.illAround[i*dimension+j] = sum
+			if p.state[i*dimension+j].visiblyIll() {
+				s.illAround[i*dimension+j]--
+			}
+			sum += rows[wrap(i+radius+1)*dimension+j] - rows[wrap(i-radius)*dimension+j]
+		}
+	}
+}
+
+// contactsKept is the share of their usual contacts a citizen keeps today, given the ones around them
+func (s *simulation) contactsKept(index personIndex) float64 {
+	perceived := s.adaptive.DeathsResponse * s.globalStats.reportedDeaths
+	side := 2*s.parameters.MaximumTravelRange + 1
+	if neighbours := side*side - 1; neighbours > 0 {
+		perceived += s.adaptive.LocalResponse * float64(s.illAround[index]) / float64(neighbours)
+	}
+	kept := 1 - (1-s.globalStats.fatigue)*perceived
+	return math.Min(1, math.Max(s.adaptive.MinimumContacts, kept))
+}
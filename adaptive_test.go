@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// adaptiveSimulation is a population nobody is sick in yet, reacting to the risk
+func adaptiveSimulation(t *testing.T, radius int) *simulation {
+	p := testParameters(t, "config.json", `{"AdaptiveBehaviour": {"LocalResponse": 2, "DeathsResponse": 0.5, "Fatigue": 20}}`)
+	p.Seed, p.MaximumTravelRange = 1, radius
+	s := newSimulation(p)
+	for index := range s.population.state {
+		s.population.state[index] = StateHealthy
+	}
+	s.globalStats, s.history = globalStatsStruct{}, []globalStatsStruct{{}}
+	return s
+}
+
+func TestCountIllAround(t *testing.T) {
+	const radius = 3
+	s := adaptiveSimulation(t, radius)
+	p := s.population
+	for index := range p.state {
+		if s.r1.Intn(5) == 0 {
+			p.state[index] = StateIll
+		}
+	}
+	s.countIllAround()
+
+	wrap := func(i int) int { return (i + p.dimension) % p.dimension }
+	for index := range p.state {
+		id := p.id(personIndex(index))
+		ill := int32(0)
+		for h := -radius; h <= radius; h++ {
+			for v := -radius; v <= radius; v++ {
+				if (h != 0 || v != 0) && p.state[wrap(id[0]+h)*p.dimension+wrap(id[1]+v)].visiblyIll() {
+					ill++
+				}
+			}
+		}
+		if s.illAround[index] != ill {
+			t.Fatalf("citizen %v: %v ill neighbours, %v counted", id, ill, s.illAround[index])
+		}
+	}
+}
+
+func TestContactsKept(t *testing.T) {
+	s := adaptiveSimulation(t, 1)
+	p := s.population
+	citizen := p.index(personID{10, 10})
+
+	// contacts fall as the neighbours fall ill, then as deaths are reported
+	s.updateVigilance()
+	if kept := s.contactsKept(citizen); kept != 1 {
+		t.Errorf("%v of the contacts kept before the epidemic", kept)
+	}
+	p.state[p.index(personID{9, 10})] = StateIll
+	p.state[p.index(personID{11, 11})] = StateUnderTreatment
+	s.countIllAround()
+	if kept := s.contactsKept(citizen); kept != 0.5 {
+		t.Errorf("%v of the contacts kept with 2 of 8 neighbours ill, 0.5 expected", kept)
+	}
+	s.globalStats.totalDead = 1 // 0.4 per 1000 citizens
+	s.globalStats.totalIll, s.globalStats.totalHospitalized = 1, 1
+
+	// and come back as the citizens tire of it
+	expected := []float64{1 - 0.8*0.7, 1 - 0.64*0.7, 1 - 0.512*0.7}
+	for day, expected := range expected {
+		s.updateVigilance()
+		if kept := s.contactsKept(citizen); math.Abs(kept-expected) > 1e-9 {
+			t.Errorf("day %v of the epidemic: %v of the contacts kept, %v expected", day+1, kept, expected)
+		}
+	}
+
+	s.adaptive.MinimumContacts = 0.5
+	s.globalStats.fatigue = 0
+	if kept := s.contactsKept(citizen); kept != 0.5 {
+		t.Errorf("%v of the contacts kept, no fewer than 0.5 expected", kept)
+	}
+}
+
+func TestBothSidesReact(t *testing.T) {
+	s := adaptiveSimulation(t, 1)
+	p := s.population
+	s.adaptive.LocalResponse = 3
+
+	// the ill on the far side of a neighbour scare them off, whoever comes to see them
+	for row := 9; row <= 11; row++ {
+		p.state[p.index(personID{row, 12})] = StateIll
+	}
+	s.countIllAround()
+
+	source := p.citizen(p.index(personID{10, 10}))
+	scared, other := p.index(personID{10, 11}), p.index(personID{10, 9})
+	metScared, metOther := 0, 0
+	for try := 0; try < 1000; try++ {
+		for _, contact := range s.getContacted(source, 1, 20, s.r1) {
+			switch contact {
+			case scared:
+				metScared++
+			case other:
+				metOther++
+			}
+		}
+	}
+	if metScared != 0 || metOther == 0 {
+		t.Errorf("the scared neighbour met %v times, the other one %v times", metScared, metOther)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Citizens may protect themselves and the others by wearing masks and keeping their distance.
+// Every citizen is given an adherence to each behaviour (1-100) at initialization, and takes the
+// behaviour up while its uptake in the population, in %, exceeds 100 - adherence: the most
+// adherent first, the same citizens from one day to the next. The uptake follows a schedule by
+// day, and may be raised while the ill make up at least PrevalenceThreshold % of the population.
+// When an infectious citizen meets a healthy one, the contact is
+//   - avoided with a SourceEfficacy chance if the infectious keeps their distance, and with a
+//     TargetEfficacy chance if the healthy one does
+//   - spared the disease with a SourceEfficacy chance if the infectious wears a mask, and with
+//     a TargetEfficacy chance if the healthy one does
+//
+// An infection is counted as averted by the behaviour that stopped it, out of those the
+// contact would have led to without any behaviour.
+
+type behaviourSpecification struct {
+	Uptake              map[int]float64 // % of the citizens taking the behaviour up from the given day on, none before the first
+	PrevalenceThreshold float64         // % of the population ill from which the uptake is at least PrevalenceUptake, 0 for never
+	PrevalenceUptake    float64
+	SourceEfficacy      float64 // 0-1, protection of the contacts of an infectious citizen who behaves
+	TargetEfficacy      float64 // 0-1, protection of a healthy citizen who behaves
+}
+
+const (
+	behaviourMasks = iota
+	behaviourDistancing
+	behaviours
+)
+
+var behaviourNames = [behaviours]string{"masks", "distancing"}
+
+type behaviourModel struct {
+	days                []int // days of the uptake schedule, in order
+	uptakes             []float64
+	prevalenceThreshold float64
+	prevalenceUptake    float64
+	sourceEfficacy      float64
+	targetEfficacy      float64
+}
+
+func compileBehaviour(name string, specification *behaviourSpecification) (*behaviourModel, error) {
+	if specification == nil {
+		return nil, nil
+	}
+
+	model := &behaviourModel{
+		prevalenceThreshold: specification.PrevalenceThreshold,
+		prevalenceUptake:    specification.PrevalenceUptake,
+		sourceEfficacy:      specification.SourceEfficacy,
+		targetEfficacy:      specification.TargetEfficacy,
+	}
+	for day := range specification.Uptake {
+		model.days = append(model.days, day)
+	}
+	sort.Ints(model.days)
+	for _, day := range model.days {
+		model.uptakes = append(model.uptakes, specification.Uptake[day])
+	}
+
+	for _, uptake := range append(model.uptakes, model.prevalenceUptake) {
+		if uptake < 0 || uptake > 100 {
+			return nil, fmt.Errorf("%v: uptake out of 0-100", name)
+		}
+	}
+	if model.sourceEfficacy < 0 || model.sourceEfficacy > 1 || model.targetEfficacy < 0 || model.targetEfficacy > 1 {
+		return nil, fmt.Errorf("%v: efficacy out of 0-1", name)
+	}
+	return model, nil
+}
+
+func (s *simulation) compileBehaviours() (err error) {
+	for b, specification := range [behaviours]*behaviourSpecification{s.parameters.Masks, s.parameters.Distancing} {
+		if s.behaviours[b], err = compileBehaviour(behaviourNames[b], specification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uptake is the % of the population taking the behaviour up on the given day
+func (m *behaviourModel) uptake(day int, globalStats *globalStatsStruct, population int) float64 {
+	uptake := 0.0
+	for i, from := range m.days {
+		if from <= day {
+			uptake = m.uptakes[i]
+		}
+	}
+	if m.prevalenceThreshold > 0 && float64(globalStats.totalIll)*100 >= m.prevalenceThreshold*float64(population) && m.prevalenceUptake > uptake {
+		uptake = m.prevalenceUptake
+	}
+	return uptake
+}
+
+// updateUptakes sets the day's uptake of every behaviour, from the prevalence of the day before
+func (s *simulation) updateUptakes() {
+	for b, model := range s.behaviours {
+		if model != nil {
+			s.globalStats.uptake[b] = model.uptake(s.globalStats.daysCount, &s.globalStats, s.parameters.TotalPopulation)
+		}
+	}
+}
+
+// allocateAdherence makes room for the adherence to the behaviours of the run the population
+// lacks, drawing it for every citizen when asked to (when forking, for instance)
+func (s *simulation) allocateAdherence(draw bool) {
+	for b, model := range s.behaviours {
+		if model == nil || s.population.adherence[b] != nil {
+			continue
+		}
+		s.population.adherence[b] = make([]uint8, s.population.size())
+		if !draw {
+			continue
+		}
+		for index := range s.population.adherence[b] {
+			s.population.adherence[b][index] = uint8(s.r1.Intn(100) + 1)
+		}
+	}
+}
+
+// drawAdherence gives a citizen their adherence to the behaviours of the run
+func (s *simulation) drawAdherence() (adherence [behaviours]uint8) {
+	for b := range adherence {
+		if s.population.adherence[b] != nil {
+			adherence[b] = uint8(s.r1.Intn(100) + 1)
+		}
+	}
+	return
+}
+
+// behaves tells whether a citizen of the given adherence takes the behaviour up today
+func (s *simulation) behaves(b int, adherence uint8) bool {
+	return s.behaviours[b] != nil && float64(adherence) > 100-s.globalStats.uptake[b]
+}
+
+// protected tells which behaviour kept a healthy citizen from catching the disease from an
+// infectious one they would have caught it from otherwise, -1 for none
+func (s *simulation) protected(current *populationType, source citizen, target personIndex, r1 *rand.Rand) int {
+	targetAdherence := current.adherence
+
+	if model := s.behaviours[behaviourDistancing]; model != nil {
+		if s.behaves(behaviourDistancing, source.adherence[behaviourDistancing]) && r1.Float64() < model.sourceEfficacy {
+			return behaviourDistancing
+		}
+		if s.behaves(behaviourDistancing, targetAdherence[behaviourDistancing][target]) && r1.Float64() < model.targetEfficacy {
+			return behaviourDistancing
+		}
+	}
+
+	if model := s.behaviours[behaviourMasks]; model != nil {
+		if s.behaves(behaviourMasks, source.adherence[behaviourMasks]) && r1.Float64() < model.sourceEfficacy {
+			return behaviourMasks
+		}
+		if s.behaves(behaviourMasks, targetAdherence[behaviourMasks][target]) && r1.Float64() < model.targetEfficacy {
+			return behaviourMasks
+		}
+	}
+	return -1
+}
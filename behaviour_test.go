@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBehaviourUptake(t *testing.T) {
+	model, err := compileBehaviour("masks", &behaviourSpecification{
+		Uptake: map[int]float64{10: 20, 30: 60}, PrevalenceThreshold: 2, PrevalenceUptake: 80,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		day, ill int
+		uptake   float64
+	}{
+		{5, 0, 0}, {10, 0, 20}, {29, 0, 20}, {40, 0, 60},
+		// 2% of the 1000 citizens ill raise the uptake
+		{5, 19, 0}, {5, 20, 80}, {40, 20, 80},
+	} {
+		if uptake := model.uptake(test.day, &globalStatsStruct{totalIll: test.ill}, 1000); uptake != test.uptake {
+			t.Errorf("day %v with %v ill: uptake %v, %v expected", test.day, test.ill, uptake, test.uptake)
+		}
+	}
+
+	for name, specification := range map[string]behaviourSpecification{
+		"uptake over 100":   {Uptake: map[int]float64{1: 120}},
+		"negative uptake":   {PrevalenceThreshold: 1, PrevalenceUptake: -5},
+		"efficacy over 1":   {SourceEfficacy: 1.5},
+		"negative efficacy": {TargetEfficacy: -0.1},
+	} {
+		if _, err := compileBehaviour(name, &specification); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+func TestProtected(t *testing.T) {
+	p := testParameters(t, "config.json", `{"Masks": {"Uptake": {"0": 50}, "SourceEfficacy": 0.5, "TargetEfficacy": 1}}`)
+	p.Seed = 1
+	s := newSimulation(p)
+	s.updateUptakes()
+
+	// the most adherent half of the citizens wear masks
+	if !s.behaves(behaviourMasks, 51) || s.behaves(behaviourMasks, 50) {
+		t.Error("the uptake doesn't split the citizens by adherence")
+	}
+
+	source := s.population.citizen(0)
+	target := personIndex(1)
+	const n = 100000
+	for _, test := range []struct {
+		name                       string
+		sourceAdherence, adherence uint8
+		share                      float64
+	}{
+		{"nobody masked", 10, 10, 0},
+		{"masked source", 90, 10, 0.5},
+		{"masked target", 10, 90, 1},
+	} {
+		source.adherence[behaviourMasks] = test.sourceAdherence
+		s.population.adherence[behaviourMasks][target] = test.adherence
+		protected := 0
+		for i := 0; i < n; i++ {
+			if s.protected(s.population, source, target, s.r1) == behaviourMasks {
+				protected++
+			}
+		}
+		if share := float64(protected) / n; math.Abs(share-test.share) > 0.01 {
+			t.Errorf("%v: %.3f of the contacts protected, %v expected", test.name, share, test.share)
+		}
+	}
+}
+
+func TestMasksSlowTheEpidemic(t *testing.T) {
+	// infections within the population over the first days, and those averted by masks
+	infections := func(overrides string) (int, int) {
+		p := testParameters(t, "config.json", overrides)
+		p.Seed = 1
+		s, err := runChecked(p, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.globalStats.totalLocal, s.globalStats.averted[behaviourMasks]
+	}
+	without, _ := infections(`{"TransitionRate": 10, "Seeding": {"Cases": {"ill": 5}}}`)
+	with, averted := infections(`{"TransitionRate": 10, "Seeding": {"Cases": {"ill": 5}}, "Masks": {"Uptake": {"0": 100}, "SourceEfficacy": 0.3, "TargetEfficacy": 0.3}}`)
+	if with >= without || averted == 0 {
+		t.Errorf("%v infections in 20 days with masks, %v without, %v averted", with, without, averted)
+	}
+}
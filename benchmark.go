@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runBenchmark reports the memory taken by the population store and the time spent per simulated day
+// for every population size in the comma-separated list
+func runBenchmark(sizes string, days int, parameters mainParametersStruct) {
+	legacy := reflect.TypeOf(citizen{}).Size()
+
+	fmt.Printf("%12v %10v %14v %14v %14v %12v %14v\n", "Agents", "Dimension", "Heap, MB", "Bytes/agent", "Struct, MB", "Init", "Step (mean)")
+	for _, size := range strings.Split(sizes, ",") {
+		agents, err := strconv.Atoi(strings.TrimSpace(size))
+		checkError("Invalid benchmark size: ", err)
+
+		p := parameters
+		p.PopulationSpaceDimension = int(math.Ceil(math.Sqrt(float64(agents))))
+		if p.Seed == 0 {
+			p.Seed = 1
+		}
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+		s := newSimulation(p)
+		initialization := time.Since(start)
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap := float64(after.HeapAlloc) - float64(before.HeapAlloc)
+
+		start = time.Now()
+		steps := 0
+		for ; steps < days && !s.finished(); steps++ {
+			s.stepDay()
+		}
+		var step time.Duration
+		if steps > 0 {
+			step = time.Since(start) / time.Duration(steps)
+		}
+
+		n := s.population.size()
+		fmt.Printf("%12v %10v %14.1f %14.2f %14.1f %12v %14v\n",
+			n,
+			s.population.dimension,
+			heap/1e6,
+			heap/float64(n),
+			float64(legacy)*float64(n)/1e6,
+			initialization.Round(time.Millisecond),
+			step.Round(time.Microsecond))
+
+		runtime.KeepAlive(s)
+	}
+	fmt.Printf("Struct: the same population stored as %v-byte citizen structs\n", legacy)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// The days of the simulation map to calendar dates, day 0 being StartDate. Every day is a
+// weekday, a weekend day or a public holiday, the holidays being read from a CSV file:
+//
+//	Date,Name
+//	2020-12-25,Christmas Day
+//	2021-01-01,New Year's Day
+//
+// Contacts may follow the type of the day, see contactMatrixSpecification.DayTypes.
+
+const (
+	dateLayout       = "2006-01-02"
+	defaultStartDate = "2020-01-01"
+)
+
+const (
+	dayWeekday = iota
+	dayWeekend
+	dayHoliday
+	dayTypes
+)
+
+var dayTypeNames = [dayTypes]string{"weekday", "weekend", "holiday"}
+
+type calendar struct {
+	start    time.Time
+	holidays map[int]bool // public holidays, by day of the simulation
+}
+
+func parseDayType(name string) (int, error) {
+	for dayType, dayTypeName := range dayTypeNames {
+		if dayTypeName == name {
+			return dayType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day type %q", name)
+}
+
+func compileCalendar(parameters *mainParametersStruct) (result calendar, err error) {
+	date := parameters.StartDate
+	if date == "" {
+		date = defaultStartDate
+	}
+	if result.start, err = time.Parse(dateLayout, date); err != nil {
+		return result, fmt.Errorf("invalid StartDate %q, YYYY-MM-DD expected", date)
+	}
+	if parameters.Holidays == "" {
+		return result, nil
+	}
+
+	file, err := os.Open(parameters.Holidays)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return result, err
+	}
+
+	result.holidays = make(map[int]bool)
+	for i, record := range records {
+		holiday, err := time.Parse(dateLayout, strings.TrimSpace(record[0]))
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return result, fmt.Errorf("%v: invalid date in row %v", parameters.Holidays, i)
+		}
+		result.holidays[int(holiday.Sub(result.start).Hours()/24)] = true
+	}
+	return result, nil
+}
+
+// date is the calendar date of a day of the simulation
+func (c calendar) date(day int) time.Time {
+	return c.start.AddDate(0, 0, day)
+}
+
+// dayType tells whether a day of the simulation is a weekday, a weekend day or a holiday
+func (c calendar) dayType(day int) int {
+	switch weekday := c.date(day).Weekday(); {
+	case c.holidays[day]:
+		return dayHoliday
+	case weekday == time.Saturday || weekday == time.Sunday:
+		return dayWeekend
+	}
+	return dayWeekday
+}
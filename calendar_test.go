@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestCompileCalendar(t *testing.T) {
+	holidays := writeFile(t, "holidays.csv", "Date,Name\n2022-01-01,New Year's Day\n2022-01-03,Substitute holiday\n")
+	c, err := compileCalendar(&mainParametersStruct{StartDate: "2021-12-30", Holidays: holidays})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if date := c.date(3).Format(dateLayout); date != "2022-01-02" {
+		t.Errorf("day 3 is %v, 2022-01-02 expected", date)
+	}
+	// Thursday, Friday, a holiday on Saturday, Sunday, a holiday on Monday, Tuesday
+	for day, expected := range []int{dayWeekday, dayWeekday, dayHoliday, dayWeekend, dayHoliday, dayWeekday} {
+		if dayType := c.dayType(day); dayType != expected {
+			t.Errorf("day %v: %v, %v expected", day, dayTypeNames[dayType], dayTypeNames[expected])
+		}
+	}
+
+	c, err = compileCalendar(&mainParametersStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date := c.date(0).Format(dateLayout); date != defaultStartDate {
+		t.Errorf("day 0 is %v, %v expected", date, defaultStartDate)
+	}
+
+	for name, parameters := range map[string]mainParametersStruct{
+		"invalid start date":   {StartDate: "30/12/2021"},
+		"invalid holiday":      {Holidays: writeFile(t, "holidays.csv", "Date,Name\n2022-01-01,New Year's Day\nsoon,Party\n")},
+		"missing holiday file": {Holidays: "missing.csv"},
+	} {
+		if _, err := compileCalendar(&parameters); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
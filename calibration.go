@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calibrationSpecification describes which parameters are fitted to an observed time series and how
+type calibrationSpecification struct {
+	Method           string  // "abc" (rejection sampling) or "nelder-mead"
+	Observed         string  // CSV with Day, Cases (new symptomatic cases) and Deaths (new deaths) columns
+	Replicates       int     // runs averaged per candidate parameter set
+	Samples          int     // prior draws for ABC
+	AcceptedFraction float64 // share of the closest ABC draws kept as the posterior
+	Iterations       int     // Nelder-Mead iteration limit
+	DeathsWeight     float64 // relative weight of the deaths series in the distance
+	Workers          int
+	Output           string // best-fit parameters
+	Posterior        string // posterior samples (ABC) or evaluated points (Nelder-Mead)
+	Fit              string // observed vs simulated series of the best fit
+	Parameters       map[string]sweepRange
+}
+
+type observedSeries struct {
+	cases  []float64
+	deaths []float64
+}
+
+// calibrationPoint is a candidate parameter set (scaled to the unit cube) with its ensemble outcome
+type calibrationPoint struct {
+	point    []float64
+	distance float64
+	cases    [][]float64 // per replicate
+	deaths   [][]float64
+}
+
+func readObserved(fn string) (observedSeries, error) {
+	var observed observedSeries
+	file, err := os.Open(fn)
+	if err != nil {
+		return observed, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return observed, err
+	}
+	if len(records) < 2 {
+		return observed, fmt.Errorf("%v: no observations", fn)
+	}
+
+	column := map[string]int{"day": -1, "cases": -1, "deaths": -1}
+	for i, name := range records[0] {
+		column[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, record := range records[1:] {
+		day := len(observed.cases)
+		if column["day"] >= 0 {
+			if day, err = strconv.Atoi(strings.TrimSpace(record[column["day"]])); err != nil || day < 0 {
+				return observed, fmt.Errorf("%v: invalid day %q", fn, record[column["day"]])
+			}
+		}
+		for len(observed.cases) <= day {
+			observed.cases = append(observed.cases, 0)
+			observed.deaths = append(observed.deaths, 0)
+		}
+		if column["cases"] >= 0 {
+			if observed.cases[day], err = strconv.ParseFloat(strings.TrimSpace(record[column["cases"]]), 64); err != nil {
+				return observed, fmt.Errorf("%v: invalid cases %q", fn, record[column["cases"]])
+			}
+		}
+		if column["deaths"] >= 0 {
+			if observed.deaths[day], err = strconv.ParseFloat(strings.TrimSpace(record[column["deaths"]]), 64); err != nil {
+				return observed, fmt.Errorf("%v: invalid deaths %q", fn, record[column["deaths"]])
+			}
+		}
+	}
+	return observed, nil
+}
+
+// dailyIncidence converts the cumulative counters of a run into new cases and new deaths per day
+func dailyIncidence(history []globalStatsStruct, days int) (cases, deaths []float64) {
+	cases = make([]float64, days)
+	deaths = make([]float64, days)
+	for day := 0; day < days && day < len(history); day++ {
+		cases[day] = float64(history[day].totalEverIll)
+		deaths[day] = float64(history[day].totalDead)
+		if day > 0 {
+			cases[day] -= float64(history[day-1].totalEverIll)
+			deaths[day] -= float64(history[day-1].totalDead)
+		}
+	}
+	return
+}
+
+func ensembleMean(series [][]float64) []float64 {
+	mean := make([]float64, len(series[0]))
+	for _, s := range series {
+		for day, v := range s {
+			mean[day] += v / float64(len(series))
+		}
+	}
+	return mean
+}
+
+func sumOfSquares(observed, simulated []float64) (result float64) {
+	for day := range observed {
+		result += (observed[day] - simulated[day]) * (observed[day] - simulated[day])
+	}
+	return
+}
+
+type calibration struct {
+	calibrationSpecification
+	parameters mainParametersStruct
+	names      []string
+	bounds     []sweepRange
+	observed   observedSeries
+	baseSeed   int64
+	evaluated  []calibrationPoint
+}
+
+// evaluate runs an ensemble for every point. Replicate i of every point shares seed baseSeed+i,
+// so differences between points are not drowned in run-to-run noise
+func (c *calibration) evaluate(points [][]float64) []calibrationPoint {
+	var jobs []sweepJob
+	for _, point := range points {
+		for replicate := 0; replicate < c.Replicates; replicate++ {
+			jobs = append(jobs, sweepJob{index: len(jobs), values: scaleToBounds(point, c.bounds), replicate: replicate + 1, seed: c.baseSeed + int64(replicate)})
+		}
+	}
+	results := runJobs(c.parameters, c.names, jobs, c.Workers)
+
+	evaluated := make([]calibrationPoint, len(points))
+	days := len(c.observed.cases)
+	for p, point := range points {
+		evaluated[p].point = point
+		for replicate := 0; replicate < c.Replicates; replicate++ {
+			cases, deaths := dailyIncidence(results[p*c.Replicates+replicate].history, days)
+			evaluated[p].cases = append(evaluated[p].cases, cases)
+			evaluated[p].deaths = append(evaluated[p].deaths, deaths)
+		}
+		evaluated[p].distance = sumOfSquares(c.observed.cases, ensembleMean(evaluated[p].cases)) +
+			c.DeathsWeight*sumOfSquares(c.observed.deaths, ensembleMean(evaluated[p].deaths))
+	}
+	c.evaluated = append(c.evaluated, evaluated...)
+	return evaluated
+}
+
+func clampToUnit(point []float64) []float64 {
+	for i := range point {
+		point[i] = math.Max(0, math.Min(1, point[i]))
+	}
+	return point
+}
+
+// nelderMead minimises the distance over the unit cube, starting from its centre,
+// and returns the best point along with the final simplex
+func (c *calibration) nelderMead() (calibrationPoint, []calibrationPoint) {
+	k := len(c.names)
+
+	var vertices [][]float64
+	centre := make([]float64, k)
+	for i := range centre {
+		centre[i] = 0.5
+	}
+	vertices = append(vertices, centre)
+	for i := 0; i < k; i++ {
+		vertex := append([]float64{}, centre...)
+		vertex[i] += 0.25
+		vertices = append(vertices, vertex)
+	}
+	simplex := c.evaluate(vertices)
+
+	combine := func(a []float64, b []float64, t float64) []float64 {
+		result := make([]float64, k)
+		for i := range result {
+			result[i] = a[i] + t*(b[i]-a[i])
+		}
+		return clampToUnit(result)
+	}
+
+	for iteration := 0; iteration < c.Iterations; iteration++ {
+		sort.Slice(simplex, func(i, j int) bool { return simplex[i].distance < simplex[j].distance })
+		best, worst := simplex[0], simplex[k]
+
+		centroid := make([]float64, k)
+		for _, vertex := range simplex[:k] {
+			for i := range centroid {
+				centroid[i] += vertex.point[i] / float64(k)
+			}
+		}
+
+		reflected := c.evaluate([][]float64{combine(centroid, worst.point, -1)})[0]
+		switch {
+		case reflected.distance < best.distance:
+			expanded := c.evaluate([][]float64{combine(centroid, worst.point, -2)})[0]
+			if expanded.distance < reflected.distance {
+				simplex[k] = expanded
+			} else {
+				simplex[k] = reflected
+			}
+		case reflected.distance < simplex[k-1].distance:
+			simplex[k] = reflected
+		default:
+			contracted := c.evaluate([][]float64{combine(centroid, worst.point, 0.5)})[0]
+			if contracted.distance < worst.distance {
+				simplex[k] = contracted
+			} else {
+				// shrink towards the best vertex
+				var shrunk [][]float64
+				for _, vertex := range simplex[1:] {
+					shrunk = append(shrunk, combine(best.point, vertex.point, 0.5))
+				}
+				simplex = append([]calibrationPoint{best}, c.evaluate(shrunk)...)
+			}
+		}
+
+		if enableDebugMessages {
+			fmt.Printf("Iteration %v: distance %v\n", iteration, simplex[0].distance)
+		}
+	}
+
+	sort.Slice(simplex, func(i, j int) bool { return simplex[i].distance < simplex[j].distance })
+	return simplex[0], simplex
+}
+
+// approximateBayesian draws from the uniform prior and keeps the closest fraction as posterior samples
+func (c *calibration) approximateBayesian(r *rand.Rand) (best calibrationPoint, posterior []calibrationPoint) {
+	draws := c.evaluate(latinHypercube(r, c.Samples, len(c.names)))
+	sort.Slice(draws, func(i, j int) bool { return draws[i].distance < draws[j].distance })
+
+	accepted := int(math.Ceil(float64(len(draws)) * c.AcceptedFraction))
+	if accepted < 1 {
+		accepted = 1
+	}
+	return draws[0], draws[:accepted]
+}
+
+// values are the parameters a point of the unit cube was simulated with
+func (c *calibration) values(point []float64) []float64 {
+	values := scaleToBounds(point, c.bounds)
+	for i, name := range c.names {
+		values[i] = simulatedValue(name, values[i])
+	}
+	return values
+}
+
+func (c *calibration) writePoints(fn string, points []calibrationPoint) {
+	file, err := os.Create(fn)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	pointsLog := csv.NewWriter(file)
+	defer pointsLog.Flush()
+
+	pointsLog.Write(append(append([]string{}, c.names...), "Distance"))
+	for _, point := range points {
+		var line []string
+		for _, value := range c.values(point.point) {
+			line = append(line, fmt.Sprintf("%v", value))
+		}
+		line = append(line, fmt.Sprintf("%v", point.distance))
+		pointsLog.Write(line)
+	}
+}
+
+func (c *calibration) writeFit(fn string, best calibrationPoint) {
+	file, err := os.Create(fn)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	fitLog := csv.NewWriter(file)
+	defer fitLog.Flush()
+
+	fitLog.Write([]string{"Day", "Observed cases", "Simulated cases", "Simulated cases min", "Simulated cases max", "Observed deaths", "Simulated deaths", "Simulated deaths min", "Simulated deaths max"})
+
+	spread := func(series [][]float64, day int) (low, high float64) {
+		low, high = math.Inf(1), math.Inf(-1)
+		for _, s := range series {
+			low, high = math.Min(low, s[day]), math.Max(high, s[day])
+		}
+		return
+	}
+
+	cases, deaths := ensembleMean(best.cases), ensembleMean(best.deaths)
+	for day := range c.observed.cases {
+		casesLow, casesHigh := spread(best.cases, day)
+		deathsLow, deathsHigh := spread(best.deaths, day)
+		fitLog.Write([]string{
+			fmt.Sprintf("%v", day),
+			fmt.Sprintf("%v", c.observed.cases[day]),
+			fmt.Sprintf("%.2f", cases[day]),
+			fmt.Sprintf("%v", casesLow),
+			fmt.Sprintf("%v", casesHigh),
+			fmt.Sprintf("%v", c.observed.deaths[day]),
+			fmt.Sprintf("%.2f", deaths[day]),
+			fmt.Sprintf("%v", deathsLow),
+			fmt.Sprintf("%v", deathsHigh),
+		})
+	}
+}
+
+func runCalibration(fn string, parameters mainParametersStruct) {
+	c := calibration{parameters: parameters}
+	readJSON(fn, &c.calibrationSpecification)
+
+	if len(c.Parameters) == 0 {
+		fmt.Println("No parameters to calibrate")
+		return
+	}
+	if c.Replicates <= 0 {
+		c.Replicates = 5
+	}
+	if c.Samples <= 0 {
+		c.Samples = 100
+	}
+	if c.AcceptedFraction <= 0 {
+		c.AcceptedFraction = 0.1
+	}
+	if c.Iterations <= 0 {
+		c.Iterations = 50
+	}
+	if c.DeathsWeight <= 0 {
+		c.DeathsWeight = 1
+	}
+	if c.Output == "" {
+		c.Output = "calibration.csv"
+	}
+	if c.Posterior == "" {
+		c.Posterior = "posterior.csv"
+	}
+	if c.Fit == "" {
+		c.Fit = "fit.csv"
+	}
+
+	for name := range c.Parameters {
+		checkError("Invalid calibration: ", setParameter(&mainParametersStruct{}, name, 0))
+		c.names = append(c.names, name)
+	}
+	sort.Strings(c.names)
+	for _, name := range c.names {
+		c.bounds = append(c.bounds, c.Parameters[name])
+	}
+
+	var err error
+	c.observed, err = readObserved(c.Observed)
+	checkError("Invalid observed series: ", err)
+
+	c.baseSeed = parameters.Seed
+	if c.baseSeed == 0 {
+		c.baseSeed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(c.baseSeed))
+
+	// posterior summarises the uncertainty of the fit, samples is what gets written out point by point
+	var best calibrationPoint
+	var posterior, samples []calibrationPoint
+	switch strings.ToLower(c.Method) {
+	case "nelder-mead", "neldermead":
+		fmt.Printf("Calibrating %v parameters with Nelder-Mead, %v replicates per point\n", len(c.names), c.Replicates)
+		best, posterior = c.nelderMead()
+		samples = c.evaluated
+	case "abc", "":
+		fmt.Printf("Calibrating %v parameters with ABC, %v draws of %v replicates\n", len(c.names), c.Samples, c.Replicates)
+		best, posterior = c.approximateBayesian(r)
+		samples = posterior
+	default:
+		checkError("Invalid calibration: ", fmt.Errorf("unknown method %q", c.Method))
+	}
+
+	file, err := os.Create(c.Output)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	calibrationLog := csv.NewWriter(file)
+	defer calibrationLog.Flush()
+
+	calibrationLog.Write([]string{"Parameter", "Best fit", "Posterior mean", "Posterior sd"})
+	bestValues := c.values(best.point)
+	for i, name := range c.names {
+		var values []float64
+		for _, point := range posterior {
+			values = append(values, c.values(point.point)[i])
+		}
+		mean, variance := meanAndVariance(values)
+		calibrationLog.Write([]string{name, fmt.Sprintf("%v", bestValues[i]), fmt.Sprintf("%.4f", mean), fmt.Sprintf("%.4f", math.Sqrt(variance))})
+		fmt.Printf("%v = %v\n", name, bestValues[i])
+	}
+	fmt.Printf("Distance: %v\n", best.distance)
+
+	c.writePoints(c.Posterior, samples)
+	c.writeFit(c.Fit, best)
+
+	fmt.Printf("Calibration written to %v, %v and %v\n", c.Output, c.Posterior, c.Fit)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"os"
+)
+
+// pcgSource is r1's source: a PCG generator whose state is written to checkpoints as it is,
+// so that resuming takes the same time however long the run has been going
+type pcgSource struct {
+	*randv2.PCG
+	seed int64 // the run's seed, the parallel engine derives the seeds of its tiles from it
+}
+
+const pcgStream = 0x5851f42d4c957f2d // second half of the PCG seed, the same for every run
+
+func newPCGSource(seed int64) *pcgSource {
+	return &pcgSource{PCG: randv2.NewPCG(uint64(seed), pcgStream), seed: seed}
+}
+
+func (p *pcgSource) Int63() int64 {
+	return int64(p.Uint64() >> 1)
+}
+
+func (p *pcgSource) Seed(seed int64) {
+	p.PCG.Seed(uint64(seed), pcgStream)
+	p.seed = seed
+}
+
+// The records below mirror the unexported simulation types field by field for encoding/gob.
+// Keep them in sync with populationType and globalStatsStruct.
+
+type populationRecord struct {
+	Dimension        int
+	Today            uint16
+	State            []State
+	Entered          []uint16
+	Infected         []uint16
+	Dwell            []uint16
+	Infectiousness   []float32
+	SelfIsolated     []bool
+	IsolatedSince    []uint16
+	Hospitality      []uint8
+	SicknessSeverity []uint8
+	Age              []uint8
+	RiskFactors      []uint8
+	Vaccinated       []bool
+	Birthday         []uint16
+	Adherence        [behaviours][]uint8
+	Treatments       []uint8
+	Onset            []uint16
+	HealthcareWorker []bool
+}
+
+type globalStatsRecord struct {
+	TotalInfected            int
+	TotalAsymptomatic        int
+	TotalRecovered           int
+	TotalIll                 int
+	TotalEverIll             int
+	TotalDead                int
+	TotalIntact              int
+	TotalSelfIsolated        int
+	TotalHospitalized        int
+	TotalICU                 int
+	CurrentMortality         int
+	DaysCount                int
+	TotalQuarantineApplied   bool
+	TotalVacant              int
+	TotalBirths              int
+	TotalNaturalDeaths       int
+	TotalImported            int
+	TotalLocal               int
+	Uptake                   [behaviours]float64
+	Averted                  [behaviours]int
+	ReportedDeaths           float64
+	Fatigue                  float64
+	CurrentlyIsolated        int
+	TreatmentCourses         [maximumTreatments]int
+	HealthcareCapacity       int
+	HealthcareWorkersMissing int
+	HealthcareInfections     int
+}
+
+type checkpointRecord struct {
+	Parameters              mainParametersStruct // exported fields only, the rest follows
+	ContactsPerDayModifiers map[State]float64
+	MortalityAmongAgeGroups map[int]float64
+	AgeGroupsDensity        [][2]int
+
+	Population  populationRecord
+	ArrayOfSick []personIndex
+	Offspring   map[personIndex]int
+	Vacant      []personIndex
+	Isolated    []personIndex
+	Staff       []personIndex
+	Pyramids    []pyramidSnapshot
+	GlobalStats globalStatsRecord
+	History     []globalStatsRecord
+
+	Seed                                       int64
+	Random                                     []byte // the state of r1's generator
+	YearsPassed                                int
+	TotalQuarantineAppliedAppliedOnPreviousDay bool
+}
+
+func (p *populationType) record() populationRecord {
+	return populationRecord{p.dimension, p.today, p.state, p.entered, p.infected, p.dwell, p.infectiousness, p.selfIsolated, p.isolatedSince, p.hospitality, p.sicknessSeverity, p.age, p.riskFactors, p.vaccinated, p.birthday, p.adherence, p.treatments, p.onset, p.healthcareWorker}
+}
+
+func (r populationRecord) population() (*populationType, error) {
+	n := r.Dimension * r.Dimension
+	for _, length := range []int{len(r.State), len(r.Entered), len(r.Infected), len(r.Dwell), len(r.Infectiousness), len(r.SelfIsolated), len(r.IsolatedSince), len(r.Hospitality), len(r.SicknessSeverity), len(r.Age), len(r.RiskFactors), len(r.Vaccinated)} {
+		if length != n {
+			return nil, fmt.Errorf("checkpoint holds %v citizens, %v expected", length, n)
+		}
+	}
+	if r.Birthday != nil && len(r.Birthday) != n {
+		return nil, fmt.Errorf("checkpoint holds %v birthdays, %v expected", len(r.Birthday), n)
+	}
+	if r.Treatments != nil && (len(r.Treatments) != n || len(r.Onset) != n) {
+		return nil, fmt.Errorf("checkpoint holds %v treatments and %v onsets, %v expected", len(r.Treatments), len(r.Onset), n)
+	}
+	if r.HealthcareWorker != nil && len(r.HealthcareWorker) != n {
+		return nil, fmt.Errorf("checkpoint holds %v healthcare workers, %v expected", len(r.HealthcareWorker), n)
+	}
+	for b, adherence := range r.Adherence {
+		if adherence != nil && len(adherence) != n {
+			return nil, fmt.Errorf("checkpoint holds %v adherences to %v, %v expected", len(adherence), behaviourNames[b], n)
+		}
+	}
+	return &populationType{r.Dimension, r.Today, r.State, r.Entered, r.Infected, r.Dwell, r.Infectiousness, r.SelfIsolated, r.IsolatedSince, r.Hospitality, r.SicknessSeverity, r.Age, r.RiskFactors, r.Vaccinated, r.Birthday, r.Adherence, r.Treatments, r.Onset, r.HealthcareWorker}, nil
+}
+
+func (g globalStatsStruct) record() globalStatsRecord {
+	return globalStatsRecord{g.totalInfected, g.totalAsymptomatic, g.totalRecovered, g.totalIll, g.totalEverIll, g.totalDead, g.totalIntact,
+		g.totalSelfIsolated, g.totalHospitalized, g.totalICU, g.currentMortality, g.daysCount, g.totalQuarantineApplied,
+		g.totalVacant, g.totalBirths, g.totalNaturalDeaths, g.totalImported, g.totalLocal, g.uptake, g.averted, g.reportedDeaths, g.fatigue, g.currentlyIsolated, g.treatmentCourses,
+		g.healthcareCapacity, g.healthcareWorkersMissing, g.healthcareInfections}
+}
+
+func (r globalStatsRecord) globalStats() globalStatsStruct {
+	return globalStatsStruct{
+		totalInfected:            r.TotalInfected,
+		totalAsymptomatic:        r.TotalAsymptomatic,
+		totalRecovered:           r.TotalRecovered,
+		totalIll:                 r.TotalIll,
+		totalEverIll:             r.TotalEverIll,
+		totalDead:                r.TotalDead,
+		totalIntact:              r.TotalIntact,
+		totalSelfIsolated:        r.TotalSelfIsolated,
+		totalHospitalized:        r.TotalHospitalized,
+		totalICU:                 r.TotalICU,
+		currentMortality:         r.CurrentMortality,
+		daysCount:                r.DaysCount,
+		totalQuarantineApplied:   r.TotalQuarantineApplied,
+		totalVacant:              r.TotalVacant,
+		totalBirths:              r.TotalBirths,
+		totalNaturalDeaths:       r.TotalNaturalDeaths,
+		totalImported:            r.TotalImported,
+		totalLocal:               r.TotalLocal,
+		uptake:                   r.Uptake,
+		averted:                  r.Averted,
+		reportedDeaths:           r.ReportedDeaths,
+		fatigue:                  r.Fatigue,
+		currentlyIsolated:        r.CurrentlyIsolated,
+		treatmentCourses:         r.TreatmentCourses,
+		healthcareCapacity:       r.HealthcareCapacity,
+		healthcareWorkersMissing: r.HealthcareWorkersMissing,
+		healthcareInfections:     r.HealthcareInfections,
+	}
+}
+
+func (s *simulation) saveCheckpoint(fn string) error {
+	record := checkpointRecord{
+		Parameters:              s.parameters,
+		ContactsPerDayModifiers: s.parameters.contactsPerDayModifiers,
+		MortalityAmongAgeGroups: s.parameters.mortalityAmongAgeGroups,
+		Population:              s.population.record(),
+		ArrayOfSick:             s.arrayOfSick,
+		Offspring:               s.offspring,
+		Vacant:                  s.vacant,
+		Isolated:                s.isolated,
+		Staff:                   s.staff,
+		Pyramids:                s.pyramids,
+		GlobalStats:             s.globalStats.record(),
+		Seed:                    s.source.seed,
+		YearsPassed:             s.yearsPassed,
+		TotalQuarantineAppliedAppliedOnPreviousDay: s.totalQuarantineAppliedAppliedOnPreviousDay,
+	}
+	for _, group := range s.parameters.ageGroupsDensity {
+		record.AgeGroupsDensity = append(record.AgeGroupsDensity, [2]int{group.upperBound, group.density})
+	}
+	for _, day := range s.history {
+		record.History = append(record.History, day.record())
+	}
+	random, err := s.source.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	record.Random = random
+
+	file, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	compressed := gzip.NewWriter(file)
+	defer compressed.Close()
+
+	return gob.NewEncoder(compressed).Encode(record)
+}
+
+func loadCheckpoint(fn string) (*simulation, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+
+	var record checkpointRecord
+	if err := gob.NewDecoder(compressed).Decode(&record); err != nil {
+		return nil, err
+	}
+	population, err := record.Population.population()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &simulation{
+		parameters:  record.Parameters,
+		population:  population,
+		arrayOfSick: record.ArrayOfSick,
+		offspring:   record.Offspring,
+		vacant:      record.Vacant,
+		isolated:    record.Isolated,
+		staff:       record.Staff,
+		pyramids:    record.Pyramids,
+		globalStats: record.GlobalStats.globalStats(),
+		source:      newPCGSource(record.Seed),
+		yearsPassed: record.YearsPassed,
+		totalQuarantineAppliedAppliedOnPreviousDay: record.TotalQuarantineAppliedAppliedOnPreviousDay,
+	}
+	if err := s.source.UnmarshalBinary(record.Random); err != nil {
+		return nil, err
+	}
+	s.r1 = rand.New(s.source)
+	if s.offspring == nil {
+		s.offspring = make(map[personIndex]int)
+	}
+
+	s.parameters.contactsPerDayModifiers = record.ContactsPerDayModifiers
+	s.parameters.mortalityAmongAgeGroups = record.MortalityAmongAgeGroups
+	for i, group := range record.AgeGroupsDensity {
+		s.parameters.ageGroupsDensity[i] = ageGroupsDensityParameters{group[0], group[1]}
+	}
+
+	for _, day := range record.History {
+		s.history = append(s.history, day.globalStats())
+	}
+
+	if err := s.compileModel(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// fork overrides the parameters found in the given file, for counterfactual runs from a common past.
+// The random stream carries on unless the file sets a different Seed.
+func (s *simulation) fork(fn string) {
+	seed := s.parameters.Seed
+	readJSON(fn, &s.parameters)
+	s.parameters.PopulationSpaceDimension = s.population.dimension
+	s.parameters.TotalPopulation = s.population.size()
+
+	if s.parameters.Seed != seed && s.parameters.Seed != 0 {
+		s.source = newPCGSource(s.parameters.Seed)
+		s.r1 = rand.New(s.source)
+	}
+
+	checkError("Invalid model: ", s.compileModel())
+	if s.demographics != nil && s.population.birthday == nil {
+		s.population.birthday = make([]uint16, s.population.size())
+	}
+	s.allocateAdherence(true)
+	s.allocateTreatments()
+	s.allocateHealthcareWorkers(true)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// play steps the simulation until the given day, or to its end when 0
+func play(s *simulation, days int) {
+	for !s.finished() && (days == 0 || s.globalStats.daysCount < days) {
+		s.stepDay()
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	const savedOn = 20
+	for _, configuration := range configurations {
+		for _, e := range engines {
+			t.Run(fmt.Sprintf("%v/%v", configuration.name, e.name), func(t *testing.T) {
+				p := testParameters(t, configuration.config, configuration.overrides)
+				p.Seed, p.Engine, p.Workers = 1, e.engine, e.workers
+				fn := filepath.Join(t.TempDir(), "checkpoint.gob")
+
+				uninterrupted := newSimulation(p)
+				play(uninterrupted, savedOn)
+				if err := uninterrupted.saveCheckpoint(fn); err != nil {
+					t.Fatal(err)
+				}
+				play(uninterrupted, configuration.days)
+
+				resumed, err := loadCheckpoint(fn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resumed.globalStats.daysCount != savedOn {
+					t.Fatalf("resumed on day %v, %v expected", resumed.globalStats.daysCount, savedOn)
+				}
+				play(resumed, configuration.days)
+
+				if !reflect.DeepEqual(uninterrupted.history, resumed.history) {
+					t.Error("the resumed run departs from the uninterrupted one")
+				}
+				if !reflect.DeepEqual(uninterrupted.population.record(), resumed.population.record()) {
+					t.Error("the resumed run ends with another population")
+				}
+			})
+		}
+	}
+}
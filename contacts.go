@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Contacts may be weighted by an age-by-age contact matrix (POLYMOD style): a neighbour is met
+// with the citizen's hospitality scaled by how many contacts of the neighbour's age a person of
+// the citizen's age has per day, relative to the largest entry of the matrix. The matrix is the
+// sum of one matrix per setting (home, school, work...), each read from a CSV file:
+//
+//	Age,0,20,65
+//	0,8.1,3.2,0.4
+//	20,2.9,6.5,0.9
+//	65,0.8,2.1,1.7
+//
+// The first row and the first column are the lower bounds of the age bands of the contacts and
+// of the citizens. While an intervention is active, every setting can be given a weight:
+// "quarantine" for the total quarantine, "selfIsolation" for the contacts of a self-isolated citizen.
+// Likewise for the type of the day, "weekday", "weekend" or "holiday" (see calendar.go): schools
+// and workplaces closed on weekends and holidays, more contacts in the community.
+
+type contactMatrixSpecification struct {
+	Settings      map[string]string             // CSV file of every setting's matrix
+	Interventions map[string]map[string]float64 // weight of every setting while the intervention is active, 1 when omitted
+	DayTypes      map[string]map[string]float64 // weight of every setting on the days of the type, 1 when omitted
+}
+
+const (
+	interventionQuarantine = 1 << iota
+	interventionSelfIsolation
+	interventionCombinations
+)
+
+// contactMatrices holds, for every type of day and combination of active interventions,
+// the relative weights of the contacts between age bands
+type contactMatrices struct {
+	bandOfAge [256]uint8
+	weights   [dayTypes][interventionCombinations][][]float64
+}
+
+func readContactMatrix(fn string) (bands []int, values [][]float64, err error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil, fmt.Errorf("%v: no age band", fn)
+	}
+
+	for _, field := range records[0][1:] {
+		bound, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: invalid age band: %v", fn, err)
+		}
+		bands = append(bands, bound)
+	}
+	if len(records) != len(bands)+1 {
+		return nil, nil, fmt.Errorf("%v: %v rows for %v age bands", fn, len(records)-1, len(bands))
+	}
+
+	for i, record := range records[1:] {
+		bound, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil || bound != bands[i] {
+			return nil, nil, fmt.Errorf("%v: row %v should be the age band %v", fn, i+1, bands[i])
+		}
+		row := make([]float64, len(bands))
+		for j := range row {
+			if row[j], err = strconv.ParseFloat(strings.TrimSpace(record[j+1]), 64); err != nil || row[j] < 0 {
+				return nil, nil, fmt.Errorf("%v: invalid contacts in row %v", fn, i+1)
+			}
+		}
+		values = append(values, row)
+	}
+	return bands, values, nil
+}
+
+func compileContactMatrices(specification *contactMatrixSpecification) (*contactMatrices, error) {
+	if specification == nil || len(specification.Settings) == 0 {
+		if specification != nil && len(specification.DayTypes) > 0 {
+			return nil, fmt.Errorf("contact patterns by day type need the settings' contact matrices")
+		}
+		return nil, nil
+	}
+
+	// settings are summed up in a fixed order, for the rounding to be the same from run to run
+	var names []string
+	for setting := range specification.Settings {
+		names = append(names, setting)
+	}
+	sort.Strings(names)
+
+	var bands []int
+	settings := make(map[string][][]float64)
+	for _, setting := range names {
+		settingBands, values, err := readContactMatrix(specification.Settings[setting])
+		if err != nil {
+			return nil, fmt.Errorf("setting %v: %v", setting, err)
+		}
+		if bands != nil && fmt.Sprint(bands) != fmt.Sprint(settingBands) {
+			return nil, fmt.Errorf("setting %v: age bands differ from the other settings", setting)
+		}
+		bands = settingBands
+		settings[setting] = values
+	}
+
+	for intervention, weights := range specification.Interventions {
+		if intervention != "quarantine" && intervention != "selfIsolation" {
+			return nil, fmt.Errorf("unknown intervention %q", intervention)
+		}
+		for setting := range weights {
+			if _, ok := settings[setting]; !ok {
+				return nil, fmt.Errorf("intervention %v: unknown setting %q", intervention, setting)
+			}
+		}
+	}
+
+	dayTypeWeights := make([]map[string]float64, dayTypes)
+	for name, weights := range specification.DayTypes {
+		dayType, err := parseDayType(name)
+		if err != nil {
+			return nil, err
+		}
+		for setting := range weights {
+			if _, ok := settings[setting]; !ok {
+				return nil, fmt.Errorf("day type %v: unknown setting %q", name, setting)
+			}
+		}
+		dayTypeWeights[dayType] = weights
+	}
+
+	matrices := &contactMatrices{}
+	for age := range matrices.bandOfAge {
+		for band, bound := range bands {
+			if age >= bound {
+				matrices.bandOfAge[age] = uint8(band)
+			}
+		}
+	}
+
+	for dayType := 0; dayType < dayTypes; dayType++ {
+		for active := 0; active < interventionCombinations; active++ {
+			combined := make([][]float64, len(bands))
+			for i := range combined {
+				combined[i] = make([]float64, len(bands))
+			}
+			for _, setting := range names {
+				values := settings[setting]
+				weight := 1.0
+				if w, ok := dayTypeWeights[dayType][setting]; ok {
+					weight *= w
+				}
+				if w, ok := specification.Interventions["quarantine"][setting]; ok && active&interventionQuarantine != 0 {
+					weight *= w
+				}
+				if w, ok := specification.Interventions["selfIsolation"][setting]; ok && active&interventionSelfIsolation != 0 {
+					weight *= w
+				}
+				for i := range values {
+					for j := range values[i] {
+						combined[i][j] += weight * values[i][j]
+					}
+				}
+			}
+			matrices.weights[dayType][active] = combined
+		}
+	}
+
+	// every combination is relative to the largest entry of an ordinary weekday,
+	// so that interventions do reduce the contacts and weekends may add some
+	reference := 0.0
+	for _, row := range matrices.weights[dayWeekday][0] {
+		for _, value := range row {
+			reference = math.Max(reference, value)
+		}
+	}
+	if reference == 0 {
+		return nil, fmt.Errorf("the contact matrix is empty")
+	}
+	for dayType := range matrices.weights {
+		for _, combined := range matrices.weights[dayType] {
+			for _, row := range combined {
+				for j := range row {
+					row[j] /= reference
+				}
+			}
+		}
+	}
+
+	return matrices, nil
+}
+
+// contactWeights are the relative weights of the age bands of the neighbours a citizen meets today
+func (s *simulation) contactWeights(c citizen) []float64 {
+	active := 0
+	if s.globalStats.totalQuarantineApplied {
+		active |= interventionQuarantine
+	}
+	if c.selfIsolated {
+		active |= interventionSelfIsolation
+	}
+	dayType := s.calendar.dayType(s.globalStats.daysCount)
+	return s.contacts.weights[dayType][active][s.contacts.bandOfAge[saturatedUint8(c.age)]]
+}
+
+func (s *simulation) contactWeight(weights []float64, neighbour personIndex) float64 {
+	return weights[s.contacts.bandOfAge[s.population.age[neighbour]]]
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestCompileContactMatrices(t *testing.T) {
+	home := writeFile(t, "home.csv", "Age,0,20,65\n0,4,2,0\n20,2,3,1\n65,0,1,2\n")
+	school := writeFile(t, "school.csv", "Age,0,20,65\n0,6,1,0\n20,1,0,0\n65,0,0,0\n")
+	matrices, err := compileContactMatrices(&contactMatrixSpecification{
+		Settings:      map[string]string{"home": home, "school": school},
+		Interventions: map[string]map[string]float64{"selfIsolation": {"school": 0}},
+		DayTypes:      map[string]map[string]float64{"weekend": {"school": 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for age, band := range map[int]uint8{0: 0, 19: 0, 20: 1, 64: 1, 65: 2, 100: 2} {
+		if matrices.bandOfAge[age] != band {
+			t.Errorf("age %v in band %v, %v expected", age, matrices.bandOfAge[age], band)
+		}
+	}
+	// the children meeting each other on a weekday are the reference, the settings add up
+	for name, test := range map[string]struct {
+		weights  [][]float64
+		children float64
+	}{
+		"weekday":        {matrices.weights[dayWeekday][0], 1},
+		"weekend":        {matrices.weights[dayWeekend][0], 0.4},
+		"self-isolation": {matrices.weights[dayWeekday][interventionSelfIsolation], 0.4},
+	} {
+		if test.weights[0][0] != test.children {
+			t.Errorf("%v: children meet each other with a weight of %v, %v expected", name, test.weights[0][0], test.children)
+		}
+		if test.weights[0][2] != 0 || test.weights[1][1] != 0.3 {
+			t.Errorf("%v: weights %v", name, test.weights)
+		}
+	}
+
+	for name, specification := range map[string]contactMatrixSpecification{
+		"unknown intervention": {Settings: map[string]string{"home": home}, Interventions: map[string]map[string]float64{"curfew": {"home": 0}}},
+		"unknown setting":      {Settings: map[string]string{"home": home}, DayTypes: map[string]map[string]float64{"weekend": {"school": 0}}},
+		"different age bands":  {Settings: map[string]string{"home": home, "work": writeFile(t, "work.csv", "Age,0,20\n0,1,1\n20,1,1\n")}},
+		"missing file":         {Settings: map[string]string{"home": "missing.csv"}},
+	} {
+		if _, err := compileContactMatrices(&specification); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+func TestContactsFollowTheMatrix(t *testing.T) {
+	p := testParameters(t, "config.json", "{}")
+	p.Seed = 1
+	p.ContactMatrix = &contactMatrixSpecification{Settings: map[string]string{"home": writeFile(t, "home.csv", "Age,0,20\n0,1,0\n20,0,1\n")}}
+	s := newSimulation(p)
+
+	// the children only meet children, the adults only adults
+	met := 0
+	for index := personIndex(0); index < 500; index++ {
+		c := s.population.citizen(index)
+		for _, contact := range s.getContacted(c, p.MaximumTravelRange, p.MaximumContactsPerDay, s.r1) {
+			if (c.age < 20) != (s.population.age[contact] < 20) {
+				t.Fatalf("a citizen of %v met one of %v", c.age, s.population.age[contact])
+			}
+			met++
+		}
+	}
+	if met == 0 {
+		t.Error("nobody met anyone")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// With demographics, citizens age a year on their own birthday instead of all together, die of
+// other causes with a yearly mortality depending on their age, and are born into the cells left
+// vacant by those deaths. The cells of the citizens killed by the disease stay theirs, so that the
+// deaths keep adding up. A population pyramid is taken at the start and at the turn of every year.
+
+const pyramidBand = 5 // years per band of the population pyramid
+
+type demographicsSpecification struct {
+	BackgroundMortality map[int]float64 // yearly deaths of other causes per 1000 citizens by age group, keyed by the group's upper age bound
+	BirthRate           float64         // yearly births per 1000 living citizens
+}
+
+type demographicsModel struct {
+	dailyMortality [math.MaxUint8 + 1]float64 // chance to die of other causes today, by age
+	dailyBirths    float64                    // births per living citizen and day
+}
+
+// pyramidSnapshot counts the living citizens of every age band
+type pyramidSnapshot struct {
+	Year   int
+	Counts []int
+}
+
+func compileDemographics(specification *demographicsSpecification) (*demographicsModel, error) {
+	if specification == nil {
+		return nil, nil
+	}
+	if specification.BirthRate < 0 {
+		return nil, fmt.Errorf("negative birth rate")
+	}
+
+	var bounds []int
+	for bound, rate := range specification.BackgroundMortality {
+		if rate < 0 || rate > 1000 {
+			return nil, fmt.Errorf("background mortality of age group %v out of 0-1000", bound)
+		}
+		bounds = append(bounds, bound)
+	}
+	sort.Ints(bounds)
+
+	model := &demographicsModel{dailyBirths: specification.BirthRate / 1000 / 365}
+	for age := range model.dailyMortality {
+		// the oldest citizens share the last group's mortality
+		yearly := 0.0
+		for _, bound := range bounds {
+			yearly = specification.BackgroundMortality[bound] / 1000
+			if age <= bound {
+				break
+			}
+		}
+		model.dailyMortality[age] = 1 - math.Pow(1-yearly, 1.0/365)
+	}
+	return model, nil
+}
+
+// demographicsDay ages, lets die and gives birth for a day; it takes the place of growAYear
+func (s *simulation) demographicsDay() {
+	p := s.population
+	dayOfYear := uint16(s.globalStats.daysCount % 365)
+
+	living, sickDied := 0, false
+	for index, state := range p.state {
+		if state == StateDead || state == StateVacant {
+			continue
+		}
+		if p.birthday[index] == dayOfYear && p.age[index] < math.MaxUint8 {
+			p.age[index]++
+		}
+		if s.r1.Float64() >= s.demographics.dailyMortality[p.age[index]] {
+			living++
+			continue
+		}
+
+		// died of other causes
+		*s.globalStats.counter(state)--
+		s.globalStats.totalVacant++
+		s.globalStats.totalNaturalDeaths++
+		sickDied = sickDied || s.followed(state)
+		p.setCitizen(citizen{state: StateVacant, daysInState: 1, personID: p.id(personIndex(index))})
+		s.vacant = append(s.vacant, personIndex(index))
+	}
+
+	if sickDied {
+		var arrayOfSick []personIndex
+		for _, index := range s.arrayOfSick {
+			if s.followed(p.stateOf(index)) {
+				arrayOfSick = append(arrayOfSick, index)
+			}
+		}
+		s.arrayOfSick = arrayOfSick
+		s.dropSettledEvents()
+	}
+
+	// births are rounded at random, and only happen where there is room
+	expected := s.demographics.dailyBirths * float64(living)
+	births := int(expected)
+	if s.r1.Float64() < expected-float64(births) {
+		births++
+	}
+	for ; births > 0 && len(s.vacant) > 0; births-- {
+		pick := s.r1.Intn(len(s.vacant))
+		index := s.vacant[pick]
+		s.vacant[pick] = s.vacant[len(s.vacant)-1]
+		s.vacant = s.vacant[:len(s.vacant)-1]
+
+		newborn := citizen{
+			state:       StateHealthy,
+			daysInState: 1,
+			personID:    p.id(index),
+			hospitality: s.r1.Intn(100) + s.parameters.BaseHospitality,
+			birthday:    int(dayOfYear),
+		}
+		newborn.riskFactors = s.drawRiskFactors(newborn.age)
+		newborn.vaccinated = s.drawVaccinated(newborn.age)
+		newborn.adherence = s.drawAdherence()
+		p.setCitizen(newborn)
+		delete(s.offspring, index)
+
+		s.globalStats.totalVacant--
+		s.globalStats.totalIntact++
+		s.globalStats.totalBirths++
+	}
+}
+
+// dropSettledEvents forgets the events of the citizens who are no longer followed,
+// once they have been taken off the sick list
+func (s *simulation) dropSettledEvents() {
+	if s.events == nil {
+		return
+	}
+	s.sickSlot = make(map[personIndex]int, len(s.arrayOfSick))
+	for slot, index := range s.arrayOfSick {
+		s.sickSlot[index] = slot
+	}
+	events := (*s.events)[:0]
+	for _, event := range *s.events {
+		if s.followed(s.population.stateOf(event.index)) {
+			events = append(events, event)
+		}
+	}
+	*s.events = events
+	heap.Init(s.events)
+}
+
+func (s *simulation) takePyramid(year int) {
+	snapshot := pyramidSnapshot{Year: year, Counts: make([]int, (math.MaxUint8+1+pyramidBand-1)/pyramidBand)}
+	last := 0
+	for index, state := range s.population.state {
+		if state != StateDead && state != StateVacant {
+			band := int(s.population.age[index]) / pyramidBand
+			snapshot.Counts[band]++
+			if band > last {
+				last = band
+			}
+		}
+	}
+	snapshot.Counts = snapshot.Counts[:last+1]
+	s.pyramids = append(s.pyramids, snapshot)
+}
+
+func (s *simulation) writePyramids(fn string) {
+	file, err := os.Create(fn)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	pyramidLog := csv.NewWriter(file)
+	defer pyramidLog.Flush()
+
+	pyramidLog.Write([]string{"Year", "Age", "Citizens"})
+	for _, snapshot := range s.pyramids {
+		for band, count := range snapshot.Counts {
+			pyramidLog.Write([]string{
+				fmt.Sprintf("%v", snapshot.Year),
+				fmt.Sprintf("%v-%v", band*pyramidBand, band*pyramidBand+pyramidBand-1),
+				fmt.Sprintf("%v", count),
+			})
+		}
+	}
+}
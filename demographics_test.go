@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompileDemographics(t *testing.T) {
+	model, err := compileDemographics(&demographicsSpecification{BackgroundMortality: map[int]float64{40: 1, 80: 50}, BirthRate: 365})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the daily chances add up to the yearly deaths per 1000, the oldest share the last group's
+	for age, expected := range map[int]float64{0: 1, 40: 1, 41: 50, 80: 50, 120: 50} {
+		if yearly := 1000 * (1 - math.Pow(1-model.dailyMortality[age], 365)); math.Abs(yearly-expected) > 1e-9 {
+			t.Errorf("age %v: %v deaths per 1000 a year, %v expected", age, yearly, expected)
+		}
+	}
+	if model.dailyBirths != 0.001 {
+		t.Errorf("%v births per citizen a day, 0.001 expected", model.dailyBirths)
+	}
+
+	for name, specification := range map[string]demographicsSpecification{
+		"negative birth rate": {BirthRate: -1},
+		"mortality over 1000": {BackgroundMortality: map[int]float64{120: 1001}},
+	} {
+		if _, err := compileDemographics(&specification); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+func TestDemographicsBalance(t *testing.T) {
+	p := testParameters(t, "config.json", `{"Demographics": {"BackgroundMortality": {"120": 100}, "BirthRate": 100}}`)
+	p.Seed = 1
+	s := newSimulation(p)
+	ages := append([]uint8{}, s.population.age...)
+
+	for s.globalStats.daysCount < 365 {
+		s.stepDay()
+
+		// every death of other causes leaves a vacant cell until a birth fills it
+		vacant := 0
+		for _, state := range s.population.state {
+			if state == StateVacant {
+				vacant++
+			}
+		}
+		g := s.globalStats
+		if vacant != g.totalVacant || vacant != len(s.vacant) || vacant != g.totalNaturalDeaths-g.totalBirths {
+			t.Fatalf("day %v: %v vacant cells, %v counted, %v listed, %v deaths and %v births",
+				g.daysCount, vacant, g.totalVacant, len(s.vacant), g.totalNaturalDeaths, g.totalBirths)
+		}
+	}
+
+	// a tenth of the citizens die of other causes in a year, and about as many are born
+	g := s.globalStats
+	if expected := float64(s.population.size()) / 10; math.Abs(float64(g.totalNaturalDeaths)-expected) > expected/4 {
+		t.Errorf("%v deaths of other causes in a year, about %v expected", g.totalNaturalDeaths, expected)
+	}
+	if g.totalBirths == 0 || g.totalBirths > g.totalNaturalDeaths {
+		t.Errorf("%v births for %v deaths of other causes", g.totalBirths, g.totalNaturalDeaths)
+	}
+
+	// the living are a year older, but the newborns
+	for index, state := range s.population.state {
+		if age := s.population.age[index]; state != StateVacant && state != StateDead && age != ages[index]+1 && age > 1 {
+			t.Fatalf("a citizen of %v is %v a year later", ages[index], age)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// A state may be given a dwell-time distribution. The time a citizen is going to spend there is
+// then sampled once, when they enter the state, and kept on the citizen. Until that day has come
+// the rules of the state are not tried; once it has, the chances of the applicable rules only weigh
+// which way the citizen goes. States without a distribution keep the daily coin flip.
+
+// dwellSpecification describes the distribution of the days spent in a state
+type dwellSpecification struct {
+	Distribution string    // fixed, exponential, gamma, lognormal, weibull or empirical
+	Mean         float64   // fixed, exponential, gamma and lognormal
+	SD           float64   // lognormal
+	Shape        float64   // gamma and weibull
+	Scale        float64   // weibull
+	Histogram    []float64 // empirical: relative frequencies of 1, 2, 3... days
+}
+
+type dwellTime func(r1 *rand.Rand) float64
+
+type dwellTable [stateCount]dwellTime
+
+func compileDwellTimes(parameters *mainParametersStruct) (table dwellTable, err error) {
+	for state, specification := range parameters.Dwell {
+		if state >= stateCount {
+			return table, fmt.Errorf("dwell time of %v: unknown state", state)
+		}
+		if state == StateHealthy || state == StateDead || state == StateVacant {
+			return table, fmt.Errorf("dwell time of %v: the state is out of the epidemic", state)
+		}
+		if table[state], err = specification.compile(); err != nil {
+			return table, fmt.Errorf("dwell time of %v: %v", state, err)
+		}
+	}
+	return table, nil
+}
+
+func (d dwellSpecification) compile() (dwellTime, error) {
+	switch d.Distribution {
+	case "fixed":
+		if d.Mean <= 0 {
+			return nil, fmt.Errorf("the Mean must be positive")
+		}
+		mean := d.Mean
+		return func(*rand.Rand) float64 { return mean }, nil
+
+	case "exponential":
+		if d.Mean <= 0 {
+			return nil, fmt.Errorf("the Mean must be positive")
+		}
+		mean := d.Mean
+		return func(r1 *rand.Rand) float64 { return r1.ExpFloat64() * mean }, nil
+
+	case "gamma":
+		if d.Mean <= 0 || d.Shape <= 0 {
+			return nil, fmt.Errorf("the Mean and Shape must be positive")
+		}
+		shape, scale := d.Shape, d.Mean/d.Shape
+		return func(r1 *rand.Rand) float64 { return sampleGamma(r1, shape) * scale }, nil
+
+	case "lognormal":
+		if d.Mean <= 0 || d.SD <= 0 {
+			return nil, fmt.Errorf("the Mean and SD must be positive")
+		}
+		// mu and sigma of the underlying normal, matching the requested mean and standard deviation
+		sigma2 := math.Log(1 + d.SD*d.SD/(d.Mean*d.Mean))
+		mu, sigma := math.Log(d.Mean)-sigma2/2, math.Sqrt(sigma2)
+		return func(r1 *rand.Rand) float64 { return math.Exp(mu + sigma*r1.NormFloat64()) }, nil
+
+	case "weibull":
+		if d.Shape <= 0 || d.Scale <= 0 {
+			return nil, fmt.Errorf("the Shape and Scale must be positive")
+		}
+		shape, scale := d.Shape, d.Scale
+		return func(r1 *rand.Rand) float64 { return scale * math.Pow(-math.Log(1-r1.Float64()), 1/shape) }, nil
+
+	case "empirical":
+		var cumulative []float64
+		total := 0.0
+		for _, frequency := range d.Histogram {
+			if frequency < 0 {
+				return nil, fmt.Errorf("negative frequency in Histogram")
+			}
+			total += frequency
+			cumulative = append(cumulative, total)
+		}
+		if total <= 0 {
+			return nil, fmt.Errorf("the Histogram is empty")
+		}
+		return func(r1 *rand.Rand) float64 {
+			pick := r1.Float64() * total
+			for day, bound := range cumulative {
+				if pick < bound {
+					return float64(day + 1)
+				}
+			}
+			return float64(len(cumulative))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown distribution %q", d.Distribution)
+}
+
+// mean is the expected number of days in the state
+func (d dwellSpecification) mean() float64 {
+	switch d.Distribution {
+	case "weibull":
+		return d.Scale * math.Gamma(1+1/d.Shape)
+	case "empirical":
+		days, total := 0.0, 0.0
+		for i, frequency := range d.Histogram {
+			days += float64(i+1) * frequency
+			total += frequency
+		}
+		return days / total
+	}
+	return d.Mean
+}
+
+// sampleGamma draws from a gamma distribution of unit scale (Marsaglia and Tsang)
+func sampleGamma(r1 *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(r1, shape+1) * math.Pow(1-r1.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r1.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r1.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// dwell samples the days a citizen entering the state is going to spend there, 0 when the state has no distribution
+func (s *simulation) dwell(state State, r1 *rand.Rand) int {
+	if s.dwellTimes[state] == nil {
+		return 0
+	}
+	return int(math.Max(1, math.Round(s.dwellTimes[state](r1))))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSampleGamma(t *testing.T) {
+	r1 := rand.New(rand.NewSource(1))
+	for _, shape := range []float64{0.3, 1, 2.5, 9} {
+		const n = 200000
+		values := make([]float64, n)
+		for i := range values {
+			if values[i] = sampleGamma(r1, shape); values[i] < 0 {
+				t.Fatalf("shape %v: negative draw %v", shape, values[i])
+			}
+		}
+		// a gamma of unit scale has the shape for mean and variance
+		mean, variance := meanAndVariance(values)
+		if math.Abs(mean-shape) > 0.02*shape+0.01 {
+			t.Errorf("shape %v: mean %v", shape, mean)
+		}
+		if math.Abs(variance-shape) > 0.05*shape+0.01 {
+			t.Errorf("shape %v: variance %v", shape, variance)
+		}
+	}
+}
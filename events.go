@@ -0,0 +1,132 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// The event-driven engine keeps the sick in a priority queue, keyed by the next day each of them
+// needs attention: every day for the infectious, who meet people, otherwise the first day a rule
+// of their state may move them on (end of incubation, onset, admission, death, recovery... as the
+// transition table has them). Only the citizens due today are played, the others are not visited.
+// The queue is ordered by day then by citizen, so it can be rebuilt from the sick list at any time,
+// after resuming from a checkpoint for instance, without changing the course of the run. The due
+// citizens are taken off the sick list and put back if still sick, so a day costs no more than
+// the citizens it plays.
+
+type scheduledEvent struct {
+	day   int
+	index personIndex
+}
+
+type eventQueue []scheduledEvent
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	return q[i].day < q[j].day || (q[i].day == q[j].day && q[i].index < q[j].index)
+}
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(scheduledEvent)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	event := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return event
+}
+
+// dueDay is the next day the citizen needs attention, -1 if no rule may ever move them on
+func (s *simulation) dueDay(c citizen) int {
+	today := s.globalStats.daysCount
+	if c.state.infectious() {
+		return today + 1
+	}
+
+	// days in state on the first day the citizen could be moved on
+	earliest := c.daysInState + 1
+	if s.dwellTimes[c.state] != nil && c.dwell+1 > earliest {
+		earliest = c.dwell + 1
+	}
+
+	best := -1
+	for _, rule := range s.transitionTable[c.state] {
+		days := earliest
+		if rule.minDays > days {
+			days = rule.minDays
+		}
+		if (rule.beforeDays > 0 && days >= rule.beforeDays) || (rule.pathway != nil && !rule.pathway(c)) {
+			continue
+		}
+		if best < 0 || days < best {
+			best = days
+		}
+	}
+	if best < 0 {
+		return -1
+	}
+	return today + best - c.daysInState
+}
+
+func (s *simulation) schedule(index personIndex) {
+	if day := s.dueDay(s.population.citizen(index)); day >= 0 {
+		heap.Push(s.events, scheduledEvent{day, index})
+	}
+}
+
+// scheduleEvents builds the queue from the sick list
+func (s *simulation) scheduleEvents() {
+	s.events = &eventQueue{}
+	s.sickSlot = make(map[personIndex]int, len(s.arrayOfSick))
+	for slot, index := range s.arrayOfSick {
+		s.sickSlot[index] = slot
+		s.schedule(index)
+	}
+}
+
+// enlist adds a citizen to the sick list and, for the event-driven engine, to the queue
+func (s *simulation) enlist(index personIndex) {
+	if s.events != nil {
+		s.sickSlot[index] = len(s.arrayOfSick)
+		s.schedule(index)
+	}
+	s.arrayOfSick = append(s.arrayOfSick, index)
+}
+
+// delist takes a citizen off the sick list, the last one of the list taking their place
+func (s *simulation) delist(index personIndex) {
+	slot, last := s.sickSlot[index], len(s.arrayOfSick)-1
+	moved := s.arrayOfSick[last]
+	s.arrayOfSick[slot] = moved
+	s.sickSlot[moved] = slot
+	s.arrayOfSick = s.arrayOfSick[:last]
+	delete(s.sickSlot, index)
+}
+
+// stepDayEvents is the event-driven counterpart of stepDay
+func (s *simulation) stepDayEvents() {
+	if s.events == nil {
+		s.scheduleEvents()
+	}
+
+	s.beginDay()
+
+	var due []personIndex
+	for s.events.Len() > 0 && (*s.events)[0].day <= s.globalStats.daysCount {
+		event := heap.Pop(s.events).(scheduledEvent)
+		due = append(due, event.index)
+		s.delist(event.index)
+	}
+	waiting := s.arrayOfSick
+
+	collected := s.collectTransitions(s.population, due, s.r1)
+	s.applyTransitions([]transitions{collected})
+
+	// the citizens played today, still sick, and the newly infected wait for their next event
+	played := s.arrayOfSick
+	s.arrayOfSick = waiting
+	for _, index := range played {
+		s.enlist(index)
+	}
+
+	s.endDay()
+}
@@ -0,0 +1,3 @@
+module virus_simul
+
+go 1.22
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// A share of the citizens of working age are healthcare workers. Those on duty care for the
+// hospitalized (under treatment or in ICU) and may catch the disease from them: every day,
+// each patient in a worker's care gives them an Exposure chance of infection. Workers who are
+// visibly ill, isolated or dead are off duty, and HealthcareCapacity falls with the share of
+// the staff missing. The staff are designated at the start; newborns never join them.
+
+const (
+	defaultHealthcareMinimumAge = 20
+	defaultHealthcareMaximumAge = 65
+)
+
+type healthcareWorkersSpecification struct {
+	Share      float64 // % of the citizens of working age who are healthcare workers
+	MinimumAge int     // youngest healthcare workers, 20 when omitted
+	MaximumAge int     // oldest healthcare workers, 65 when omitted
+	Exposure   float64 // daily chance, in %, that a worker on duty catches the disease from each patient in their care
+}
+
+func compileHealthcareWorkers(specification *healthcareWorkersSpecification) (*healthcareWorkersSpecification, error) {
+	if specification == nil {
+		return nil, nil
+	}
+	model := *specification
+	if model.MinimumAge == 0 {
+		model.MinimumAge = defaultHealthcareMinimumAge
+	}
+	if model.MaximumAge == 0 {
+		model.MaximumAge = defaultHealthcareMaximumAge
+	}
+	switch {
+	case model.Share < 0 || model.Share > 100:
+		return nil, fmt.Errorf("healthcare workers: share out of 0-100")
+	case model.MinimumAge < 0 || model.MaximumAge < model.MinimumAge:
+		return nil, fmt.Errorf("healthcare workers: wrong working ages %v-%v", model.MinimumAge, model.MaximumAge)
+	case model.Exposure < 0 || model.Exposure > 100:
+		return nil, fmt.Errorf("healthcare workers: exposure out of 0-100")
+	}
+	return &model, nil
+}
+
+// drawHealthcareWorker tells whether a citizen of the given age is one of the staff
+func (s *simulation) drawHealthcareWorker(age int) bool {
+	if s.population.healthcareWorker == nil || age < s.healthcare.MinimumAge || age > s.healthcare.MaximumAge {
+		return false
+	}
+	return s.r1.Float64()*100 < s.healthcare.Share
+}
+
+// allocateHealthcareWorkers makes room for the staff if the population lacks them,
+// designating them among the living citizens when asked to (when forking, for instance)
+func (s *simulation) allocateHealthcareWorkers(draw bool) {
+	if s.healthcare == nil || s.population.healthcareWorker != nil {
+		return
+	}
+	s.population.healthcareWorker = make([]bool, s.population.size())
+	if !draw {
+		return
+	}
+	for index, state := range s.population.state {
+		if state != StateDead && state != StateVacant {
+			s.population.healthcareWorker[index] = s.drawHealthcareWorker(int(s.population.age[index]))
+		}
+	}
+	s.listStaff()
+}
+
+// listStaff keeps the healthcare workers just designated
+func (s *simulation) listStaff() {
+	for index, worker := range s.population.healthcareWorker {
+		if worker {
+			s.staff = append(s.staff, personIndex(index))
+		}
+	}
+}
+
+// onDuty tells whether a healthcare worker is at work today; the staff who died and were
+// replaced by a newborn are missing for good
+func (s *simulation) onDuty(index personIndex) bool {
+	c := s.population.citizen(index)
+	return c.healthcareWorker && c.state != StateDead && c.state != StateVacant && !c.state.visiblyIll() && !c.selfIsolated
+}
+
+// healthcareDay exposes the workers on duty to the hospitalized and takes stock of the staff
+// missing, at the end of a day
+func (s *simulation) healthcareDay() {
+	s.globalStats.healthcareCapacity = s.parameters.HealthcareCapacity
+	if s.healthcare == nil {
+		return
+	}
+
+	var onDuty []personIndex
+	for _, index := range s.staff {
+		if s.onDuty(index) {
+			onDuty = append(onDuty, index)
+		}
+	}
+
+	if patients := s.globalStats.totalHospitalized + s.globalStats.totalICU; patients > 0 && len(onDuty) > 0 && s.healthcare.Exposure > 0 {
+		chance := 1 - math.Pow(1-s.healthcare.Exposure/100, float64(patients)/float64(len(onDuty)))
+		for _, index := range onDuty {
+			if s.population.stateOf(index) == StateHealthy && s.r1.Float64() < chance {
+				s.infectWorker(index)
+			}
+		}
+	}
+
+	missing := len(s.staff) - len(onDuty)
+	s.globalStats.healthcareWorkersMissing = missing
+	if len(s.staff) > 0 {
+		s.globalStats.healthcareCapacity = s.parameters.HealthcareCapacity * (len(s.staff) - missing) / len(s.staff)
+	}
+}
+
+// infectWorker makes a healthcare worker catch the disease from their patients
+func (s *simulation) infectWorker(index personIndex) {
+	s.infect(index, StateSusceptible)
+	s.enlist(index)
+
+	s.globalStats.totalInfected++
+	s.globalStats.totalIntact--
+	s.globalStats.totalLocal++
+	s.globalStats.healthcareInfections++
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHealthcareCapacity(t *testing.T) {
+	p := testParameters(t, "hospital.json", `{}`)
+	p.Seed = 1
+	s := newSimulation(p)
+	staff := len(s.staff)
+	if staff < 8 {
+		t.Fatalf("%v healthcare workers", staff)
+	}
+
+	// a quarter of the staff ill, another quarter isolated
+	missing := staff / 4 * 2
+	for n, index := range s.staff[:missing] {
+		c := s.population.citizen(index)
+		if n%2 == 0 {
+			c.state = StateIll
+		} else {
+			c.state, c.selfIsolated = StateHealthy, true
+		}
+		s.population.setCitizen(c)
+	}
+	s.healthcareDay()
+	capacity := p.HealthcareCapacity * (staff - missing) / staff
+	if s.globalStats.healthcareCapacity != capacity || s.globalStats.healthcareWorkersMissing != missing {
+		t.Fatalf("capacity %v with %v of the staff missing, %v with %v expected",
+			s.globalStats.healthcareCapacity, s.globalStats.healthcareWorkersMissing, capacity, missing)
+	}
+
+	// mortality doubles once the patients fill the beds the staff left can care for
+	for _, test := range []struct {
+		patients  int
+		mortality int
+	}{
+		{capacity - 1, p.MortalityRate},
+		{capacity, p.MortalityRate * 2},
+		{p.HealthcareCapacity, p.MortalityRate * 2},
+	} {
+		s.globalStats.totalHospitalized = test.patients
+		s.beginDay()
+		if s.globalStats.currentMortality != test.mortality {
+			t.Errorf("mortality %v with %v patients for %v beds, %v expected",
+				s.globalStats.currentMortality, test.patients, capacity, test.mortality)
+		}
+	}
+}
+
+func TestStaffShortageOverload(t *testing.T) {
+	p := testParameters(t, "hospital.json", `{}`)
+	p.Seed = 1
+	s := newSimulation(p)
+
+	// days the hospitals are overloaded only for want of staff, mortality doubling the next day
+	shortages := 0
+	for !s.finished() {
+		patients, beds := s.globalStats.totalHospitalized+s.globalStats.totalICU, s.globalStats.healthcareCapacity
+		overloaded := patients >= beds && patients < p.HealthcareCapacity
+		s.stepDay()
+		if overloaded {
+			shortages++
+			if s.globalStats.currentMortality != p.MortalityRate*2 {
+				t.Errorf("day %v: mortality %v with %v patients for %v beds", s.globalStats.daysCount,
+					s.globalStats.currentMortality, patients, beds)
+			}
+		}
+	}
+	if shortages == 0 || s.globalStats.healthcareInfections == 0 {
+		t.Errorf("%v days overloaded for want of staff, %v workers infected", shortages, s.globalStats.healthcareInfections)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes the content to a file of the test's temporary directory, returning its path
+func writeFile(t *testing.T, name, content string) string {
+	fn := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The epidemic starts from the cases of Seeding, one ill citizen in a random cell by default,
+// and may be fed by infections imported from outside the population afterwards: a number of
+// cases a day drawn from a Poisson distribution of mean DailyRate until LastDay, and/or the
+// cases of a schedule read from a CSV file, the day being a day of the simulation or a date:
+//
+//	Day,Cases
+//	10,3
+//	2020-03-01,5
+//
+// Imported cases arrive at the end of the day, in random healthy cells, and are counted apart
+// from the infections acquired within the population. The seeds count as imported.
+
+type seedingSpecification struct {
+	Cases    map[State]int // initial cases by state: "susceptible" (exposed), "infected" (asymptomatic) or "ill"
+	Location []int         // row and column of the cell the cases cluster around, random cells when omitted
+	Radius   int           // the clustered cases are at most this far from Location
+}
+
+type importationSpecification struct {
+	DailyRate float64 // mean number of cases imported every day
+	LastDay   int     // the last day of the daily imports, required with DailyRate
+	Schedule  string  // CSV file of the cases imported on given days
+	State     State   // state the imported cases arrive in, "susceptible" (exposed) when omitted
+}
+
+type importationModel struct {
+	dailyRate float64
+	dailyTill int         // the last day of the daily imports
+	lastDay   int         // the last day any case may be imported
+	schedule  map[int]int // cases by day of the simulation
+	state     State
+}
+
+// seedable tells whether citizens may start in the state as the disease's newcomers
+func seedable(state State) bool {
+	return state == StateSusceptible || state == StateInfected || state == StateIll
+}
+
+func readImportSchedule(fn string, days calendar) (map[int]int, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%v: no imported case", fn)
+	}
+
+	schedule := make(map[int]int)
+	for i, record := range records[1:] {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%v: row %v should be day,cases", fn, i+1)
+		}
+		field := strings.TrimSpace(record[0])
+		day, err := strconv.Atoi(field)
+		if err != nil {
+			date, dateErr := time.Parse(dateLayout, field)
+			if dateErr != nil {
+				return nil, fmt.Errorf("%v: invalid day in row %v", fn, i+1)
+			}
+			day = int(date.Sub(days.start).Hours() / 24)
+		}
+		cases, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil || cases < 0 || day < 1 {
+			return nil, fmt.Errorf("%v: invalid cases or day before the first in row %v", fn, i+1)
+		}
+		schedule[day] += cases
+	}
+	return schedule, nil
+}
+
+func compileImportation(specification *importationSpecification, days calendar) (*importationModel, error) {
+	if specification == nil {
+		return nil, nil
+	}
+
+	model := &importationModel{dailyRate: specification.DailyRate, state: specification.State}
+	if model.state == StateHealthy {
+		model.state = StateSusceptible
+	}
+	if !seedable(model.state) {
+		return nil, fmt.Errorf("importation: cases cannot arrive %v", model.state)
+	}
+	if model.dailyRate < 0 {
+		return nil, fmt.Errorf("importation: negative daily rate")
+	}
+	if model.dailyRate > 0 {
+		if specification.LastDay <= 0 {
+			return nil, fmt.Errorf("importation: a daily rate needs the last day of the imports")
+		}
+		model.dailyTill, model.lastDay = specification.LastDay, specification.LastDay
+	}
+
+	if specification.Schedule != "" {
+		schedule, err := readImportSchedule(specification.Schedule, days)
+		if err != nil {
+			return nil, fmt.Errorf("importation: %v", err)
+		}
+		model.schedule = schedule
+		for day := range schedule {
+			if day > model.lastDay {
+				model.lastDay = day
+			}
+		}
+	}
+	return model, nil
+}
+
+// samplePoisson draws from a Poisson distribution, in steps small enough for exp not to underflow
+func samplePoisson(r1 *rand.Rand, mean float64) (result int) {
+	for ; mean > 0; mean -= 30 {
+		limit := math.Exp(-math.Min(mean, 30))
+		for product := r1.Float64(); product > limit; product *= r1.Float64() {
+			result++
+		}
+	}
+	return
+}
+
+// seedCases places the initial cases of the epidemic
+func (s *simulation) seedCases() error {
+	seeding := s.parameters.Seeding
+	cases := seeding.Cases
+	if len(cases) == 0 {
+		cases = map[State]int{StateIll: 1}
+	}
+
+	total := 0
+	for state, count := range cases {
+		if !seedable(state) || count < 0 {
+			return fmt.Errorf("%v cases cannot start %v", count, state)
+		}
+		total += count
+	}
+	if total > s.population.size() {
+		return fmt.Errorf("%v cases for %v citizens", total, s.population.size())
+	}
+
+	dimension := s.population.dimension
+	var cluster []personIndex
+	if len(seeding.Location) > 0 {
+		if len(seeding.Location) != 2 {
+			return fmt.Errorf("the location is a row and a column")
+		}
+		for k := seeding.Location[0] - seeding.Radius; k <= seeding.Location[0]+seeding.Radius; k++ {
+			for m := seeding.Location[1] - seeding.Radius; m <= seeding.Location[1]+seeding.Radius; m++ {
+				cluster = append(cluster, s.population.index(personID{(k%dimension + dimension) % dimension, (m%dimension + dimension) % dimension}))
+			}
+		}
+	}
+
+	// states in a fixed order, for the draws to be the same from run to run
+	for state := State(0); state < stateCount; state++ {
+		for n := 0; n < cases[state]; n++ {
+			var index personIndex
+			if cluster != nil {
+				if len(cluster) == 0 {
+					return fmt.Errorf("more cases than cells around the location")
+				}
+				pick := s.r1.Intn(len(cluster))
+				index = cluster[pick]
+				cluster[pick] = cluster[len(cluster)-1]
+				cluster = cluster[:len(cluster)-1]
+			} else {
+				index = s.population.index(personID{s.r1.Intn(dimension), s.r1.Intn(dimension)})
+			}
+			if s.population.stateOf(index) != StateHealthy {
+				n-- // taken already, draw again
+				continue
+			}
+			s.importCase(index, state)
+		}
+	}
+	return nil
+}
+
+// importCase makes a healthy citizen one of the cases coming from outside
+func (s *simulation) importCase(index personIndex, state State) {
+	s.infect(index, state)
+	s.enlist(index)
+
+	*s.globalStats.counter(state)++
+	s.globalStats.totalIntact--
+	s.globalStats.totalImported++
+	if state == StateIll {
+		s.globalStats.totalEverIll++
+	}
+}
+
+// importDay brings in the day's imported cases
+func (s *simulation) importDay() {
+	day := s.globalStats.daysCount
+	cases := s.importation.schedule[day]
+	if day <= s.importation.dailyTill {
+		cases += samplePoisson(s.r1, s.importation.dailyRate)
+	}
+
+	dimension := s.population.dimension
+	for ; cases > 0; cases-- {
+		// a case finding nobody healthy after a few tries is lost
+		for try := 0; try < 100; try++ {
+			index := s.population.index(personID{s.r1.Intn(dimension), s.r1.Intn(dimension)})
+			if s.population.stateOf(index) == StateHealthy {
+				s.importCase(index, s.importation.state)
+				break
+			}
+		}
+	}
+}
+
+// importing tells whether cases may still be imported after today
+func (s *simulation) importing() bool {
+	return s.importation != nil && s.globalStats.daysCount < s.importation.lastDay
+}
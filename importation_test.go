@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSamplePoisson(t *testing.T) {
+	r1 := rand.New(rand.NewSource(1))
+	if samplePoisson(r1, 0) != 0 {
+		t.Error("a mean of 0 should give no case")
+	}
+	// means above 30 are drawn in several parts
+	for _, mean := range []float64{0.5, 4, 75} {
+		const n = 100000
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(samplePoisson(r1, mean))
+		}
+		m, variance := meanAndVariance(values)
+		if math.Abs(m-mean) > 0.02*mean+0.01 {
+			t.Errorf("mean %v: sample mean %v", mean, m)
+		}
+		if math.Abs(variance-mean) > 0.05*mean+0.01 {
+			t.Errorf("mean %v: variance %v", mean, variance)
+		}
+	}
+}
+
+func TestReadImportSchedule(t *testing.T) {
+	days, err := compileCalendar(&mainParametersStruct{StartDate: "2020-02-20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := readImportSchedule(writeFile(t, "imports.csv", "Day,Cases\n10,3\n2020-03-01,5\n12,1\n"), days)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2020-03-01 is day 10
+	if schedule[10] != 8 || schedule[12] != 1 || len(schedule) != 2 {
+		t.Errorf("schedule %v, 8 cases on day 10 and 1 on day 12 expected", schedule)
+	}
+
+	for name, content := range map[string]string{
+		"empty file":       "",
+		"header only":      "Day,Cases\n",
+		"single column":    "Day\n10\n",
+		"invalid day":      "Day,Cases\nsoon,3\n",
+		"negative cases":   "Day,Cases\n10,-1\n",
+		"before the start": "Day,Cases\n2020-01-01,3\n",
+	} {
+		if _, err := readImportSchedule(writeFile(t, "imports.csv", content), days); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
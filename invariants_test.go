@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// allowed tells whether a citizen may go from one state to another within a day:
+// staying put, catching the disease or bringing it from outside, or following a rule of the transition table
+func (table *transitionTable) allowed(from, to State) bool {
+	if from == to || (from == StateHealthy && seedable(to)) {
+		return true
+	}
+	// a rule may also lead back to health, and the citizen catch the disease again the same day
+	return table.leads(from, to) || (table.leads(from, StateHealthy) && seedable(to))
+}
+
+// demographicChange tells whether a change of state within a day takes a death of other causes,
+// a birth into the cell, or both; the newborn may also catch or bring in the disease on their first day
+func demographicChange(from, to State) (died, born, ok bool) {
+	if from == StateDead {
+		return false, false, false
+	}
+	died = from != StateVacant
+	born = to == StateHealthy || seedable(to)
+	return died, born, to == StateVacant || born
+}
+
+// census counts the citizens of every state straight from the grid
+func (p *populationType) census() (result [stateCount]int) {
+	for _, state := range p.state {
+		result[state]++
+	}
+	return
+}
+
+// checkInvariants verifies the day just played against the population of the day before
+func (s *simulation) checkInvariants(previous *populationType) error {
+	census := s.population.census()
+
+	total, sick := 0, 0
+	for state := State(0); state < stateCount; state++ {
+		count := *s.globalStats.counter(state)
+		if count != census[state] {
+			return fmt.Errorf("day %v: %v %v citizens counted, %v on the grid", s.globalStats.daysCount, count, state, census[state])
+		}
+		total += count
+		if s.followed(state) {
+			sick += count
+		}
+	}
+	if total != s.parameters.TotalPopulation {
+		return fmt.Errorf("day %v: population of %v, %v expected", s.globalStats.daysCount, total, s.parameters.TotalPopulation)
+	}
+
+	deaths, births := 0, 0 // changes of state only a death of other causes or a birth explain
+	for index := range s.population.state {
+		before, after := previous.citizen(personIndex(index)), s.population.citizen(personIndex(index))
+		if !s.transitionTable.allowed(before.state, after.state) {
+			died, born, ok := demographicChange(before.state, after.state)
+			if !ok {
+				return fmt.Errorf("day %v: citizen %v went from %v to %v", s.globalStats.daysCount, after.personID, before.state, after.state)
+			}
+			if died {
+				deaths++
+			}
+			if born {
+				births++
+			}
+		}
+		if before.state != after.state && after.daysInState != 1 {
+			return fmt.Errorf("day %v: citizen %v became %v %v days ago", s.globalStats.daysCount, after.personID, after.state, after.daysInState)
+		}
+		if s.dwellTimes[after.state] != nil && after.dwell == 0 {
+			return fmt.Errorf("day %v: citizen %v is %v with no dwell time", s.globalStats.daysCount, after.personID, after.state)
+		}
+	}
+
+	yesterday := s.history[len(s.history)-2]
+	if deaths > s.globalStats.totalNaturalDeaths-yesterday.totalNaturalDeaths || births > s.globalStats.totalBirths-yesterday.totalBirths {
+		return fmt.Errorf("day %v: %v deaths of other causes and %v births on the grid, %v and %v counted", s.globalStats.daysCount, deaths, births,
+			s.globalStats.totalNaturalDeaths-yesterday.totalNaturalDeaths, s.globalStats.totalBirths-yesterday.totalBirths)
+	}
+
+	listed := make(map[personIndex]bool)
+	for _, index := range s.arrayOfSick {
+		if listed[index] {
+			return fmt.Errorf("day %v: citizen %v listed as sick twice", s.globalStats.daysCount, s.population.id(index))
+		}
+		listed[index] = true
+		if state := s.population.stateOf(index); !s.followed(state) {
+			return fmt.Errorf("day %v: citizen %v listed as sick while %v", s.globalStats.daysCount, s.population.id(index), state)
+		}
+	}
+	if len(listed) != sick {
+		return fmt.Errorf("day %v: %v citizens listed as sick, %v on the grid", s.globalStats.daysCount, len(listed), sick)
+	}
+
+	isolated := 0
+	for index, selfIsolated := range s.population.selfIsolated {
+		if state := s.population.state[index]; selfIsolated && state != StateDead && state != StateVacant {
+			isolated++
+		}
+	}
+	if isolated != len(s.isolated) || isolated != s.globalStats.currentlyIsolated {
+		return fmt.Errorf("day %v: %v citizens isolated, %v listed, %v counted", s.globalStats.daysCount, isolated, len(s.isolated), s.globalStats.currentlyIsolated)
+	}
+
+	if s.events != nil {
+		queued := make(map[personIndex]bool)
+		for _, event := range *s.events {
+			if queued[event.index] || !listed[event.index] || event.day <= s.globalStats.daysCount {
+				return fmt.Errorf("day %v: citizen %v wrongly scheduled for day %v", s.globalStats.daysCount, s.population.id(event.index), event.day)
+			}
+			queued[event.index] = true
+		}
+		if len(s.sickSlot) != len(s.arrayOfSick) {
+			return fmt.Errorf("day %v: %v citizens listed as sick, %v slots", s.globalStats.daysCount, len(s.arrayOfSick), len(s.sickSlot))
+		}
+		for slot, index := range s.arrayOfSick {
+			if s.sickSlot[index] != slot {
+				return fmt.Errorf("day %v: citizen %v listed at %v, slot %v", s.globalStats.daysCount, s.population.id(index), slot, s.sickSlot[index])
+			}
+		}
+		for index := range listed {
+			if !queued[index] && s.dueDay(s.population.citizen(index)) >= 0 {
+				return fmt.Errorf("day %v: citizen %v is sick but not scheduled", s.globalStats.daysCount, s.population.id(index))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *populationType) clone() *populationType {
+	return &populationType{
+		dimension:        p.dimension,
+		today:            p.today,
+		state:            append([]State{}, p.state...),
+		entered:          append([]uint16{}, p.entered...),
+		infected:         append([]uint16{}, p.infected...),
+		dwell:            append([]uint16{}, p.dwell...),
+		infectiousness:   append([]float32{}, p.infectiousness...),
+		selfIsolated:     append([]bool{}, p.selfIsolated...),
+		isolatedSince:    append([]uint16{}, p.isolatedSince...),
+		hospitality:      append([]uint8{}, p.hospitality...),
+		sicknessSeverity: append([]uint8{}, p.sicknessSeverity...),
+		age:              append([]uint8{}, p.age...),
+		riskFactors:      append([]uint8{}, p.riskFactors...),
+		vaccinated:       append([]bool{}, p.vaccinated...),
+		birthday:         append([]uint16(nil), p.birthday...),
+		adherence:        [behaviours][]uint8{append([]uint8(nil), p.adherence[0]...), append([]uint8(nil), p.adherence[1]...)},
+		treatments:       append([]uint8(nil), p.treatments...),
+		onset:            append([]uint16(nil), p.onset...),
+		healthcareWorker: append([]bool(nil), p.healthcareWorker...),
+	}
+}
+
+// every feature of the model at once, on a course of the disease that goes through hospital and ICU,
+// has an asymptomatic pathway and immunity that wanes
+const everyFeature = `{
+	"Transitions": [
+		{"From": "ill", "To": "underTreatment", "MinDays": 2, "Probability": {"Rate": 8, "BySeverity": {"0": 0, "1": 0.2, "2": 3, "3": 5}}},
+		{"From": "ill", "To": "dead", "Probability": {"Rate": "CurrentMortality"}},
+		{"From": "ill", "To": "recovered", "MinDays": "DaysBeforeSelfRecovery", "Probability": {"Rate": "SelfRecoveryRate", "Scale": 0.5}},
+		{"From": "underTreatment", "To": "icu", "Probability": {"Rate": 10}},
+		{"From": "underTreatment", "To": "recovered", "MinDays": 5, "Probability": {"Rate": 20}},
+		{"From": "icu", "To": "dead", "Probability": {"Rate": 8}},
+		{"From": "icu", "To": "recovered", "MinDays": 3, "Probability": {"Rate": 15}},
+		{"From": "susceptible", "To": "ill", "MinDays": "GrayPeriod", "Pathway": "symptomatic", "Probability": {"Rate": "InfectionRate"}},
+		{"From": "susceptible", "To": "infected", "MinDays": "GrayPeriod", "Pathway": "asymptomatic", "Probability": {"Rate": "InfectionRate"}},
+		{"From": "susceptible", "To": "recovered", "MinDays": "DaysBeforeSelfRecovery", "BeforeDays": "GrayPeriod", "Probability": {"Rate": "SelfRecoveryRate"}},
+		{"From": "infected", "To": "recovered", "MinDays": "DaysBeforeSelfRecovery", "Probability": {"Rate": "SelfRecoveryRate", "Scale": 0.5}},
+		{"From": "recovered", "To": "healthy", "MinDays": 20, "Probability": {"Rate": 10}}
+	],
+	"AsymptomaticSeverities": [0],
+	"AsymptomaticInfectiousness": 0.5,
+	"InfectiousnessCurve": [0.5, 1, 1.5, 1, 0.6],
+	"ContactMatrix": {
+		"Settings": {"home": "contacts_home.csv", "work": "contacts_work.csv", "school": "contacts_school.csv", "other": "contacts_other.csv"},
+		"Interventions": {"selfIsolation": {"work": 0, "school": 0, "other": 0.2}},
+		"DayTypes": {"weekend": {"work": 0.2, "school": 0}, "holiday": {"work": 0.1, "school": 0}}
+	},
+	"StartDate": "2020-03-01",
+	"Holidays": "holidays.csv",
+	"Seasonality": {"Amplitude": 0.3, "PeakDay": 15},
+	"RiskFactors": [{"Name": "Diabetes", "Prevalence": {"40": 5, "120": 20}, "Severe": 2, "Death": 1.5}],
+	"VaccinationCoverage": {"40": 10, "120": 60},
+	"Variant": "delta",
+	"Severity": {
+		"ByAge": {"20": {"Severe": 0.5, "Critical": 0.5}, "120": {"Severe": 2, "Critical": 3}},
+		"ByRiskFactor": {"Diabetes": {"Critical": 2}},
+		"Vaccinated": {"Severe": 0.2, "Critical": 0.1},
+		"ByVariant": {"delta": {"Severe": 1.5}}
+	},
+	"Dwell": {"icu": {"Distribution": "gamma", "Mean": 6, "Shape": 3}},
+	"InfectiousnessDispersion": 0.5,
+	"Demographics": {"BackgroundMortality": {"120": 40}, "BirthRate": 40},
+	"Seeding": {"Cases": {"susceptible": 3, "ill": 2}},
+	"Importation": {"DailyRate": 0.5, "LastDay": 30},
+	"Masks": {"Uptake": {"10": 40}, "SourceEfficacy": 0.5, "TargetEfficacy": 0.3},
+	"Distancing": {"PrevalenceThreshold": 2, "PrevalenceUptake": 50, "SourceEfficacy": 0.4, "TargetEfficacy": 0.4},
+	"AdaptiveBehaviour": {"LocalResponse": 2, "DeathsResponse": 0.5, "MinimumContacts": 0.3, "Fatigue": 2},
+	"Isolation": {"Duration": 10, "TestAfter": 5, "TestInterval": 2, "TestSensitivity": 0.8, "ComplianceDecay": 5},
+	"Treatments": [
+		{"Name": "Antiviral", "MinimumAge": 50, "WithinDays": 5, "DailySupply": 5, "Hospitalization": 0.5},
+		{"Name": "Steroids", "States": ["underTreatment", "icu"], "Mortality": 0.6, "ICUStay": 0.8}
+	],
+	"HealthcareWorkers": {"Share": 10, "Exposure": 40}
+}`
+
+var engines = []struct {
+	name    string
+	engine  string
+	workers int
+}{
+	{"sequential", "sequential", 0},
+	{"parallel, 1 worker", "parallel", 1},
+	{"parallel, 4 workers", "parallel", 4},
+	{"events", "events", 0},
+}
+
+var configurations = []struct {
+	name      string
+	config    string // the example config the overrides apply to
+	overrides string
+	days      int // the runs are cut short, demographics keep the disease going for years
+}{
+	{"default", "config.json", "{}", 0},
+	{"hospital", "hospital.json", "{}", 0},
+	{"every feature", "config.json", everyFeature, 200},
+}
+
+func testParameters(t *testing.T, config, overrides string) mainParametersStruct {
+	parameters := loadParameters(config)
+	if err := json.Unmarshal([]byte(overrides), &parameters); err != nil {
+		t.Fatal(err)
+	}
+	return parameters
+}
+
+// runChecked plays a simulation for the given number of days, or to its end when 0,
+// checking the invariants after every day
+func runChecked(parameters mainParametersStruct, days int) (*simulation, error) {
+	s := newSimulation(parameters)
+	for !s.finished() && (days == 0 || s.globalStats.daysCount < days) {
+		previous := s.population.clone()
+		s.stepDay()
+		if err := s.checkInvariants(previous); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func TestInvariants(t *testing.T) {
+	for _, configuration := range configurations {
+		for _, e := range engines {
+			for seed := int64(1); seed <= 3; seed++ {
+				t.Run(fmt.Sprintf("%v/%v/seed %v", configuration.name, e.name, seed), func(t *testing.T) {
+					p := testParameters(t, configuration.config, configuration.overrides)
+					p.Seed, p.Engine, p.Workers = seed, e.engine, e.workers
+					if _, err := runChecked(p, configuration.days); err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestReproducibility(t *testing.T) {
+	for _, configuration := range configurations {
+		for _, e := range engines {
+			t.Run(fmt.Sprintf("%v/%v", configuration.name, e.name), func(t *testing.T) {
+				p := testParameters(t, configuration.config, configuration.overrides)
+				p.Seed, p.Engine, p.Workers = 1, e.engine, e.workers
+				first, err := runChecked(p, configuration.days)
+				if err != nil {
+					t.Fatal(err)
+				}
+				second, _ := runChecked(p, configuration.days)
+				if !reflect.DeepEqual(first.history, second.history) {
+					t.Error("two runs with the same seed differ")
+				}
+			})
+		}
+	}
+}
+
+func TestWorkerCountIndependence(t *testing.T) {
+	for _, configuration := range configurations {
+		for seed := int64(1); seed <= 3; seed++ {
+			t.Run(fmt.Sprintf("%v/seed %v", configuration.name, seed), func(t *testing.T) {
+				var histories [][]globalStatsStruct
+				for _, workers := range []int{1, 4} {
+					p := testParameters(t, configuration.config, configuration.overrides)
+					p.Seed, p.Engine, p.Workers = seed, "parallel", workers
+					s, err := runChecked(p, configuration.days)
+					if err != nil {
+						t.Fatal(err)
+					}
+					histories = append(histories, s.history)
+				}
+				if !reflect.DeepEqual(histories[0], histories[1]) {
+					t.Error("results depend on the number of workers")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// A citizen who self-isolates on falling ill starts an isolation episode. Left to themselves,
+// they stay isolated for good; Isolation may release them after a number of days, or once a
+// test comes back negative, and make them less compliant as the episode drags on: every day of
+// isolation lowers the SelfIsolationStrictness they keep their contacts away with. The dead
+// no longer count as isolated.
+
+type isolationSpecification struct {
+	Duration        int     // days an episode lasts, 0 for no limit
+	TestAfter       int     // day of the episode the citizen is first tested for release, 0 for no tests
+	TestInterval    int     // days between the tests while they come back positive, 1 when omitted
+	TestSensitivity float64 // chance of a positive test while infected, 0-1, 1 when omitted
+	ComplianceDecay float64 // % of their strictness isolated citizens lose every day of the episode
+}
+
+func compileIsolation(specification isolationSpecification) (isolationSpecification, error) {
+	if specification.TestInterval == 0 {
+		specification.TestInterval = 1
+	}
+	if specification.TestSensitivity == 0 {
+		specification.TestSensitivity = 1
+	}
+	switch {
+	case specification.Duration < 0 || specification.TestAfter < 0 || specification.TestInterval < 0:
+		return specification, fmt.Errorf("isolation: negative number of days")
+	case specification.TestSensitivity < 0 || specification.TestSensitivity > 1:
+		return specification, fmt.Errorf("isolation: test sensitivity out of 0-1")
+	case specification.ComplianceDecay < 0 || specification.ComplianceDecay > 100:
+		return specification, fmt.Errorf("isolation: compliance decay out of 0-100")
+	}
+	return specification, nil
+}
+
+// isolationStrictness is the chance, in %, that an isolated citizen keeps a contact away
+// on the given day of their episode
+func (s *simulation) isolationStrictness(daysIsolated int) int {
+	if s.isolation.ComplianceDecay == 0 {
+		return s.parameters.SelfIsolationStrictness
+	}
+	compliance := math.Pow(1-s.isolation.ComplianceDecay/100, float64(daysIsolated-1))
+	return int(math.Floor(float64(s.parameters.SelfIsolationStrictness) * compliance))
+}
+
+// released tells whether an isolated citizen's episode ends today
+func (s *simulation) released(c citizen) bool {
+	rules := s.isolation
+	if rules.Duration > 0 && c.daysIsolated >= rules.Duration {
+		return true
+	}
+	if rules.TestAfter == 0 || c.daysIsolated < rules.TestAfter || (c.daysIsolated-rules.TestAfter)%rules.TestInterval != 0 {
+		return false
+	}
+	infected := c.state != StateHealthy && !c.state.settled()
+	return !infected || s.r1.Float64() >= rules.TestSensitivity
+}
+
+// endIsolations releases the citizens whose episode is over and forgets the dead, at the end of a day
+func (s *simulation) endIsolations() {
+	isolated := s.isolated[:0]
+	for _, index := range s.isolated {
+		c := s.population.citizen(index)
+		switch {
+		case !c.selfIsolated || c.state == StateDead || c.state == StateVacant:
+		case s.released(c):
+			s.population.selfIsolated[index] = false
+		default:
+			isolated = append(isolated, index)
+		}
+	}
+	s.isolated = isolated
+	s.globalStats.currentlyIsolated = len(isolated)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+const tries = 2000
+
+// daysKept counts the days an isolated citizen infects nobody, out of many tries of the same day;
+// with every contact infected, those are the days they kept to their isolation
+func daysKept(t *testing.T, strictness int, decay float64, daysIsolated int) int {
+	p := testParameters(t, "config.json", `{"TransitionRate": 100}`)
+	p.Seed, p.SelfIsolationStrictness, p.Isolation.ComplianceDecay = 1, strictness, decay
+	s := newSimulation(p)
+
+	index := s.arrayOfSick[0]
+	c := s.population.citizen(index)
+	c.selfIsolated, c.daysIsolated = true, daysIsolated
+	s.population.setCitizen(c)
+
+	kept := 0
+	for try := 0; try < tries; try++ {
+		if len(s.collectTransitions(s.population, []personIndex{index}, s.r1).infections) == 0 {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestIsolationStrictness(t *testing.T) {
+	for _, test := range []struct {
+		name               string
+		strictness         int
+		decay              float64
+		daysIsolated, kept int
+	}{
+		{"strict", 100, 0, 5, tries},
+		{"strict on the first day", 100, 100, 1, tries},
+		{"compliance gone on the second day", 100, 100, 2, 0},
+		{"no strictness", 0, 0, 1, 0},
+	} {
+		if kept := daysKept(t, test.strictness, test.decay, test.daysIsolated); kept != test.kept {
+			t.Errorf("%v: isolated %v days out of %v, %v expected", test.name, kept, tries, test.kept)
+		}
+	}
+}
@@ -3,60 +3,20 @@ package main
 import (
 	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
 type personID [2]int
 
-type personStates struct {
-	Healthy        string
-	Susceptible    string
-	Infected       string
-	Ill            string
-	UnderTreatment string
-	ICU            string
-	Recovered      string
-	Dead           string
-}
-
-func newpersonStates() *personStates {
-	return &personStates{
-		Healthy:        "healthy",
-		Susceptible:    "susceptible",    // = exposed
-		Infected:       "infected",       // = asymptomatic
-		Ill:            "ill",            // = symptomatic
-		UnderTreatment: "underTreatment", // = hospitalization
-		ICU:            "icu",            // = ventilation / ICU
-		Recovered:      "recovered",      // = positive outcome
-		Dead:           "dead",           // = negative outcome
-	}
-}
-
-// FIXME: see type severityLevelDistribution map[string]int
-type sicknessSeverityLevels struct {
-	Low      int // 30% NS (asymptomatic) / Recovery
-	Mild     int // 56% 5D NS / 5-6D Symptomatic / Recovery
-	Severe   int // 10% 5D NS / 5-6D S / 7-8D Hospitalization / Recovery
-	Critical int // 4% 5D NS / 5-6D S / 5-6D H / 8-9D ICU / Death
-}
-
-func newsicknessSeverityLevels() *sicknessSeverityLevels {
-	return &sicknessSeverityLevels{
-		Low:      100,
-		Mild:     70,
-		Severe:   14,
-		Critical: 4,
-	}
-}
-
 type ageGroupsDensityParameters struct{ upperBound, density int }
 
-type severityLevelDistribution map[string]int
-type contactsPerDayModifiers map[string]float64
+type contactsPerDayModifiers map[State]float64
 type mortalityAmongAgeGroups map[int]float64
 type ageGroupsDensity [5]ageGroupsDensityParameters
 
@@ -75,7 +35,35 @@ type mainParametersStruct struct {
 	SelfIsolationStrictness        int
 	TotalQuarantineAppliedTreshold int
 	BaseHospitality                int
-	severityLevelDistribution
+	PopulationSpaceDimension       int                             // side of the square grid, TotalPopulation follows from it
+	Seed                           int64                           // 0 means "seed from the clock"
+	Engine                         string                          // "sequential" (default), "parallel" or "events"
+	Workers                        int                             // goroutines of the parallel engine, defaults to the number of CPUs
+	TileSize                       int                             // side of the square tiles the parallel engine splits the grid into
+	Transitions                    []transitionRuleSpecification   // course of the disease, see defaultTransitions
+	Dwell                          map[State]dwellSpecification    // days spent in a state, sampled at entry; see dwell.go
+	AsymptomaticSeverities         []int                           // sickness severities that never show symptoms
+	AsymptomaticInfectiousness     float64                         // infectiousness of the asymptomatic relative to the ill
+	InfectiousnessCurve            []float64                       // infectiousness by day since infection, the last value holds afterwards
+	InfectiousnessDispersion       float64                         // k of the gamma distribution of individual infectiousness, 0 for none
+	ContactMatrix                  *contactMatrixSpecification     // age-by-age contacts, uniform when omitted; see contacts.go
+	RiskFactors                    []riskFactorSpecification       // comorbidities raising the chance of severe disease and death; see risk.go
+	SeverityLevelsDistribution     map[string]float64              // % of the cases of every severity level: Low, Mild, Severe and Critical
+	Severity                       severitySpecification           // how the severity of a case depends on the citizen; see severity.go
+	VaccinationCoverage            map[int]float64                 // % vaccinated before the epidemic by age group, keyed by the group's upper age bound
+	Variant                        string                          // the circulating variant, see severitySpecification.ByVariant
+	Demographics                   *demographicsSpecification      // births, deaths of other causes and daily ageing, none when omitted; see demographics.go
+	StartDate                      string                          // calendar date of day 0, YYYY-MM-DD, January 1st 2020 when omitted
+	Holidays                       string                          // CSV file of the public holidays; see calendar.go
+	Seeding                        seedingSpecification            // initial cases, a single ill citizen in a random cell when omitted; see importation.go
+	Importation                    *importationSpecification       // cases coming from outside the population, none when omitted
+	Masks                          *behaviourSpecification         // mask wearing, none when omitted; see behaviour.go
+	Distancing                     *behaviourSpecification         // keeping one's distance, none when omitted
+	AdaptiveBehaviour              *adaptiveBehaviourSpecification // contacts given up as the risk is perceived, none when omitted; see adaptive.go
+	Isolation                      isolationSpecification          // release and compliance of the self-isolated, isolated for good when omitted; see isolation.go
+	Seasonality                    *seasonalitySpecification       // seasonal forcing of transmission, none when omitted; see seasonality.go
+	Treatments                     []treatmentSpecification        // therapeutics given to the eligible sick, none when omitted; see therapeutics.go
+	HealthcareWorkers              *healthcareWorkersSpecification // staff the HealthcareCapacity depends on, a static capacity when omitted; see healthcare.go
 	contactsPerDayModifiers
 	mortalityAmongAgeGroups
 	ageGroupsDensity
@@ -91,41 +79,101 @@ func readJSON(fn string, v interface{}) {
 	}
 }
 
-var mainParameters mainParametersStruct
+// loadParameters returns the built-in defaults overridden by whatever the config file provides
+func loadParameters(fn string) mainParametersStruct {
+	parameters := mainParametersStruct{}
+	parameters.SeverityLevelsDistribution = map[string]float64{
+		"Critical": 4,  // 5D NS / 5-6D S / 5-6D H / 8-9D ICU / Death
+		"Severe":   10, // 5D NS / 5-6D S / 7-8D Hospitalization / Recovery
+		"Mild":     56, // 5D NS / 5-6D Symptomatic / Recovery
+		"Low":      30, // NS (asymptomatic) / Recovery
+	}
 
-var personState = newpersonStates()
-var sicknessSeverity = newsicknessSeverityLevels()
+	parameters.contactsPerDayModifiers = make(contactsPerDayModifiers)
+	parameters.contactsPerDayModifiers[StateHealthy] = 1.0
+	parameters.contactsPerDayModifiers[StateRecovered] = 1.0
+	parameters.contactsPerDayModifiers[StateSusceptible] = 0.5
+	parameters.contactsPerDayModifiers[StateIll] = 0.5
+	parameters.contactsPerDayModifiers[StateInfected] = 0.5
+	parameters.contactsPerDayModifiers[StateUnderTreatment] = 0.06
+	parameters.contactsPerDayModifiers[StateICU] = 0.01
+	parameters.contactsPerDayModifiers[StateDead] = 0.0
+
+	parameters.mortalityAmongAgeGroups = make(mortalityAmongAgeGroups)
+	parameters.mortalityAmongAgeGroups[9] = 0.0
+	parameters.mortalityAmongAgeGroups[39] = 0.2
+	parameters.mortalityAmongAgeGroups[49] = 0.4
+	parameters.mortalityAmongAgeGroups[59] = 1.3
+	parameters.mortalityAmongAgeGroups[69] = 3.6
+	parameters.mortalityAmongAgeGroups[79] = 8.0
+	parameters.mortalityAmongAgeGroups[99] = 14.8
+
+	parameters.ageGroupsDensity[0] = ageGroupsDensityParameters{10, 3}
+	parameters.ageGroupsDensity[1] = ageGroupsDensityParameters{25, 16}
+	parameters.ageGroupsDensity[2] = ageGroupsDensityParameters{40, 48}
+	parameters.ageGroupsDensity[3] = ageGroupsDensityParameters{75, 87}
+	parameters.ageGroupsDensity[4] = ageGroupsDensityParameters{100, 100}
+
+	parameters.AsymptomaticInfectiousness = 1.0
+
+	readJSON(fn, &parameters)
+
+	return parameters
+}
+
+var mainParameters mainParametersStruct
 
 type citizen struct {
-	state            string
+	state            State
 	daysInState      int
-	selfIsolated     bool //self-isolation restricts daily contacts with a SelfIsolationStrictness probability
-	hospitality      int  //the more hospitality the more total nember of contacts per day to allowed maximum of MaximumContactsPerDay
-	sicknessSeverity int  //defines a probability to recover without medical treatment
-	age              int  //current age
-	personID              //person's Digital Passport :)
+	daysInfected     int     //days since the citizen caught the disease
+	dwell            int     //days to spend in the current state before moving on, 0 when the state has no dwell time
+	infectiousness   float64 //individual infectiousness, relative to the average citizen
+	selfIsolated     bool    //self-isolation restricts daily contacts with a SelfIsolationStrictness probability
+	daysIsolated     int     //days since the citizen's isolation began, that day included
+	hospitality      int     //the more hospitality the more total nember of contacts per day to allowed maximum of MaximumContactsPerDay
+	sicknessSeverity int     //severity level of the current case, drawn at infection
+	age              int     //current age
+	riskFactors      uint8   //bit set of the citizen's risk factors, see mainParametersStruct.RiskFactors
+	vaccinated       bool
+	birthday         int               //day of the year the citizen gets a year older, with demographics only
+	adherence        [behaviours]uint8 //1-100, the more adherent the earlier the citizen takes a behaviour up
+	treatments       uint8             //bit set of the treatments the citizen received, see mainParametersStruct.Treatments
+	daysSinceOnset   int               //days since the citizen's symptoms showed up, that day included, with treatments only
+	healthcareWorker bool
+	personID         //person's Digital Passport :)
 }
 
-const populationSpaceDimension = 50
-
-type populationType [populationSpaceDimension][populationSpaceDimension]citizen
-
 type globalStatsStruct struct {
-	totalInfected          int
-	totalRecovered         int
-	totalIll               int
-	totalDead              int
-	totalIntact            int
-	totalSelfIsolated      int
-	totalHospitalized      int
-	totalICU               int
-	currentMortality       int
-	daysCount              int
-	totalQuarantineApplied bool
+	totalInfected            int
+	totalAsymptomatic        int
+	totalRecovered           int
+	totalIll                 int
+	totalEverIll             int // cumulative number of symptomatic cases, daily incidence is its increment
+	totalDead                int
+	totalIntact              int
+	totalSelfIsolated        int
+	totalHospitalized        int
+	totalICU                 int
+	currentMortality         int
+	daysCount                int
+	totalQuarantineApplied   bool
+	totalVacant              int // empty cells
+	totalBirths              int
+	totalNaturalDeaths       int                    // deaths of other causes
+	totalImported            int                    // infections coming from outside the population, the seeds included
+	totalLocal               int                    // infections caught within the population
+	uptake                   [behaviours]float64    // % of the population taking every behaviour up today
+	averted                  [behaviours]int        // infections averted by every behaviour
+	reportedDeaths           float64                // deaths over the last days per 1000 citizens, with adaptive behaviour
+	fatigue                  float64                // share of their vigilance the citizens lost, with adaptive behaviour
+	currentlyIsolated        int                    // totalSelfIsolated counts every isolation ever
+	treatmentCourses         [maximumTreatments]int // courses delivered of every treatment
+	healthcareCapacity       int                    // HealthcareCapacity, less the share of the healthcare workers missing
+	healthcareWorkersMissing int                    // healthcare workers ill, isolated or dead
+	healthcareInfections     int                    // healthcare workers infected by their patients
 }
 
-var globalStats globalStatsStruct
-
 func (globalStats globalStatsStruct) String() string {
 	return fmt.Sprintf("Day: %v\nDead: %v\nIll: %v\nInfected: %v\nSelf-isolated: %v\nRecovered: %v\nIntact: %v\nCurrent mortality: %v",
 		// return fmt.Sprintf("%v,%v,%v,%v,%v",
@@ -141,11 +189,96 @@ func (globalStats globalStatsStruct) String() string {
 
 const enableDebugMessages = false
 
-func (p *populationType) getContacted(referencePerson citizen, radius, maximumContacts int) []personID {
+// simulation holds everything a single run needs, so several runs may be executed side by side
+type simulation struct {
+	parameters      mainParametersStruct
+	globalStats     globalStatsStruct
+	population      *populationType
+	arrayOfSick     []personIndex
+	offspring       map[personIndex]int // citizens infected by each citizen, those who infected nobody left out
+	events          *eventQueue         // the sick by due day, for the event-driven engine
+	sickSlot        map[personIndex]int // where each of the sick is in arrayOfSick, for the event-driven engine
+	transitionTable transitionTable
+	dwellTimes      dwellTable
+	contacts        *contactMatrices // nil when contacts don't depend on age
+	riskFactors     []riskFactor
+	severity        severityModel
+	demographics    *demographicsModel
+	vacant          []personIndex     // cells emptied by deaths of other causes, waiting for births
+	pyramids        []pyramidSnapshot // with demographics, the population by age at the start and every year
+	calendar        calendar
+	seasonality     *seasonalityModel               // nil when transmission doesn't follow the seasons
+	importation     *importationModel               // nil when no case comes from outside
+	behaviours      [behaviours]*behaviourModel     // nil for the behaviours nobody takes up
+	adaptive        *adaptiveBehaviourSpecification // nil when the citizens don't react to the risk
+	illAround       []int32                         // visibly ill neighbours of every cell this morning, for the adaptive behaviour
+	isolation       isolationSpecification
+	isolated        []personIndex // the living citizens currently in isolation
+	treatments      []treatment
+	healthcare      *healthcareWorkersSpecification // nil when nobody is designated a healthcare worker
+	staff           []personIndex                   // the healthcare workers designated at the start
+	r1              *rand.Rand
+	source          *pcgSource // r1's source, kept to be able to checkpoint the random stream
+
+	yearsPassed                                int
+	totalQuarantineAppliedAppliedOnPreviousDay bool
+
+	history []globalStatsStruct // a snapshot of globalStats for every simulated day, day 0 included
+	verbose bool                // print yearly and quarantine announcements
+
+	checkpointFile  string // may contain a %v verb for the day number
+	checkpointEvery int    // days between checkpoints, 0 disables them
+}
 
-	var neighboursArray []personID
+func newSimulation(parameters mainParametersStruct) *simulation {
+	seed := parameters.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := &simulation{
+		parameters: parameters,
+		source:     newPCGSource(seed),
+		offspring:  make(map[personIndex]int),
+	}
+	s.r1 = rand.New(s.source)
+
+	checkError("Invalid model: ", s.compileModel())
+
+	dimension := s.parameters.dimension()
+	s.population = newPopulation(dimension)
+	if s.demographics != nil {
+		s.population.birthday = make([]uint16, s.population.size())
+	}
+	s.allocateAdherence(false)
+	s.allocateTreatments()
+	s.allocateHealthcareWorkers(false)
+	s.population.initialize(s)
+	s.listStaff()
+
+	s.parameters.TotalPopulation = dimension * dimension
+
+	s.globalStats.totalIntact = s.parameters.TotalPopulation
+
+	// a random person gets ill, unless the seeding says otherwise
+	checkError("Invalid seeding: ", s.seedCases())
+	s.healthcareDay()
 
-	var allNeighbours []personID
+	if s.demographics != nil {
+		s.takePyramid(0)
+	}
+
+	s.history = append(s.history, s.globalStats)
+
+	return s
+}
+
+func (s *simulation) getContacted(referencePerson citizen, radius, maximumContacts int, r1 *rand.Rand) []personIndex {
+
+	var neighboursArray []personIndex
+	dimension := s.population.dimension
+
+	var allNeighbours []personIndex
 	for hOffset := -radius; hOffset <= radius; hOffset++ {
 		for vOffset := -radius; vOffset <= radius; vOffset++ {
 			if (hOffset == 0) && (vOffset == 0) {
@@ -156,33 +289,52 @@ func (p *populationType) getContacted(referencePerson citizen, radius, maximumCo
 
 			switch {
 			case k < 0:
-				k = populationSpaceDimension + k
-			case k >= populationSpaceDimension:
-				k = k - populationSpaceDimension
+				k = dimension + k
+			case k >= dimension:
+				k = k - dimension
 			}
 
 			switch {
 			case m < 0:
-				m = populationSpaceDimension + m
-			case m >= populationSpaceDimension:
-				m = m - populationSpaceDimension
+				m = dimension + m
+			case m >= dimension:
+				m = m - dimension
 			}
 
-			allNeighbours = append(allNeighbours, personID{k, m})
+			allNeighbours = append(allNeighbours, personIndex(k*dimension+m))
 		}
 	}
 
 	//pick "maximum" number of points as a result
-	candidatesToBePicked := int(float64(maximumContacts) * mainParameters.contactsPerDayModifiers[referencePerson.state])
+	candidatesToBePicked := int(float64(maximumContacts) * s.parameters.contactsPerDayModifiers[referencePerson.state])
 
 	// fmt.Printf("%v of %v candidates picked due to %v state %v limit\n", candidatesToBePicked, maximumContacts, mainParameters.contactsPerDayModifiers[referencePerson.state], referencePerson.state)
 
-	s1 := rand.NewSource(time.Now().UnixNano())
-	r1 := rand.New(s1)
+	var weights []float64
+	if s.contacts != nil {
+		weights = s.contactWeights(referencePerson)
+	}
+
+	baseHospitality := referencePerson.hospitality
+	if s.adaptive != nil {
+		baseHospitality = int(float64(baseHospitality) * s.contactsKept(s.population.index(referencePerson.personID)))
+	}
 
 	for _, candidate := range allNeighbours {
 
-		if r1.Intn(100) <= referencePerson.hospitality {
+		hospitality := baseHospitality
+		if weights != nil {
+			weight := s.contactWeight(weights, candidate)
+			if weight == 0 {
+				continue
+			}
+			hospitality = int(float64(hospitality) * weight)
+		}
+		if s.adaptive != nil {
+			hospitality = int(float64(hospitality) * s.contactsKept(candidate))
+		}
+
+		if r1.Intn(100) < hospitality {
 			neighboursArray = append(neighboursArray, candidate) //personID{candidate[0], candidate[1]})
 			candidatesToBePicked--
 		}
@@ -195,103 +347,24 @@ func (p *populationType) getContacted(referencePerson citizen, radius, maximumCo
 	return neighboursArray
 }
 
-func (p *populationType) growAYear() {
-	for i := 0; i < populationSpaceDimension; i++ {
-		for j := 0; j < populationSpaceDimension; j++ {
-			if p[i][j].state != personState.Dead {
-				p[i][j].age++
-			}
-		}
-	}
-}
-
-func (p *populationType) tickNextDay() {
-	for i := 0; i < populationSpaceDimension; i++ {
-		for j := 0; j < populationSpaceDimension; j++ {
-			if p[i][j].state != personState.Dead {
-				p[i][j].daysInState++
-			}
-		}
-	}
-}
-
-func (p *populationType) initialize() {
-
-	s1 := rand.NewSource(time.Now().UnixNano())
-	r1 := rand.New(s1)
-	r2 := rand.New(s1)
-
-	for i := 0; i < populationSpaceDimension; i++ {
-		for j := 0; j < populationSpaceDimension; j++ {
-			p[i][j] = citizen{
-				state:            personState.Healthy,
-				personID:         personID{i, j},
-				hospitality:      r1.Intn(100) + mainParameters.BaseHospitality,
-				sicknessSeverity: r1.Intn(4),
-				age:              getAge(r2.Intn(100)),
-			}
-		}
-	}
-}
-
-func (p *populationType) logPopulation() {
-	filePopulationDescr, err := os.Create("population.csv")
-	checkError("Cannot create file", err)
-	defer filePopulationDescr.Close()
-
-	populationLog := csv.NewWriter(filePopulationDescr)
-	defer populationLog.Flush()
-	line := []string{"ID", "Age", "Days", "Hospitality", "Self-Isolated", "Sickness severity", "State"}
-	populationLog.Write(line)
-
-	for i := 0; i < populationSpaceDimension; i++ {
-		for j := 0; j < populationSpaceDimension; j++ {
-			line := []string{
-				fmt.Sprintf("[%v, %v]", i, j),
-				fmt.Sprintf("%v", p[i][j].age),
-				fmt.Sprintf("%v", p[i][j].daysInState),
-				fmt.Sprintf("%v", p[i][j].hospitality),
-				fmt.Sprintf("%v", p[i][j].selfIsolated),
-				fmt.Sprintf("%v", p[i][j].sicknessSeverity),
-				fmt.Sprintf("%v", p[i][j].state),
-			}
-			populationLog.Write(line)
-		}
-	}
-
-}
-
 func checkError(message string, err error) {
 	if err != nil {
 		log.Fatal(message, err)
 	}
 }
 
-func removeSick(pArray []personID, index int) []personID {
-	if index <= len(pArray)-1 {
-		pArray[index] = pArray[len(pArray)-1] // Copy last element to index i.
-		pArray[len(pArray)-1] = personID{}    // Erase last element (write zero value).
-		pArray = pArray[:len(pArray)-1]
-	}
-
-	return pArray
-}
-
-func getAge(rnd int) (age int) {
+func (s *simulation) getAge(rnd int) (age int) {
 	// var ageGroups = [5]int{10, 25, 40, 75, 100}
 	// var ageGroupsDensity = [5]int{3, 16, 48, 87, 100}
 
-	s1 := rand.NewSource(time.Now().UnixNano())
-	// r1 := rand.New(s1)
-	r2 := rand.New(s1)
+	groups := s.parameters.ageGroupsDensity
 
-	// rnd := r1.Intn(100)
-	if rnd <= mainParameters.ageGroupsDensity[0].density {
-		age = r2.Intn(mainParameters.ageGroupsDensity[0].upperBound)
+	if rnd <= groups[0].density {
+		age = s.r1.Intn(groups[0].upperBound)
 	} else {
-		for idx, val := range mainParameters.ageGroupsDensity {
+		for idx, val := range groups {
 			if rnd <= val.density {
-				age = r2.Intn(mainParameters.ageGroupsDensity[idx].upperBound-mainParameters.ageGroupsDensity[idx-1].upperBound) + mainParameters.ageGroupsDensity[idx-1].upperBound
+				age = s.r1.Intn(groups[idx].upperBound-groups[idx-1].upperBound) + groups[idx-1].upperBound
 				break
 			}
 		}
@@ -317,321 +390,270 @@ func getAge(rnd int) (age int) {
 	return
 }
 
-func main() {
-	mainParameters = mainParametersStruct{}
-	//FIXME: resolve potential descriptive parameter doubling
-	mainParameters.severityLevelDistribution = make(severityLevelDistribution)
-	mainParameters.severityLevelDistribution["Critical"] = 4
-	mainParameters.severityLevelDistribution["Severe"] = 10
-	mainParameters.severityLevelDistribution["Mild"] = 56
-	mainParameters.severityLevelDistribution["Low"] = 30
-
-	mainParameters.contactsPerDayModifiers = make(contactsPerDayModifiers)
-	mainParameters.contactsPerDayModifiers[personState.Healthy] = 1.0
-	mainParameters.contactsPerDayModifiers[personState.Recovered] = 1.0
-	mainParameters.contactsPerDayModifiers[personState.Susceptible] = 0.5
-	mainParameters.contactsPerDayModifiers[personState.Ill] = 0.5
-	mainParameters.contactsPerDayModifiers[personState.Infected] = 0.5
-	mainParameters.contactsPerDayModifiers[personState.UnderTreatment] = 0.06
-	mainParameters.contactsPerDayModifiers[personState.ICU] = 0.01
-	mainParameters.contactsPerDayModifiers[personState.Dead] = 0.0
-
-	mainParameters.mortalityAmongAgeGroups = make(mortalityAmongAgeGroups)
-	mainParameters.mortalityAmongAgeGroups[9] = 0.0
-	mainParameters.mortalityAmongAgeGroups[39] = 0.2
-	mainParameters.mortalityAmongAgeGroups[49] = 0.4
-	mainParameters.mortalityAmongAgeGroups[59] = 1.3
-	mainParameters.mortalityAmongAgeGroups[69] = 3.6
-	mainParameters.mortalityAmongAgeGroups[79] = 8.0
-	mainParameters.mortalityAmongAgeGroups[99] = 14.8
-
-	mainParameters.ageGroupsDensity[0] = ageGroupsDensityParameters{10, 3}
-	mainParameters.ageGroupsDensity[1] = ageGroupsDensityParameters{25, 16}
-	mainParameters.ageGroupsDensity[2] = ageGroupsDensityParameters{40, 48}
-	mainParameters.ageGroupsDensity[3] = ageGroupsDensityParameters{75, 87}
-	mainParameters.ageGroupsDensity[4] = ageGroupsDensityParameters{100, 100}
-
-	readJSON("config.json", &mainParameters)
-
-	//FIXME: find out how to set a range dynamically
-	// const count = int(math.Floor(math.Sqrt(float64(mainParameters.TotalPopulation))))
-
-	//initialize
-	s1 := rand.NewSource(time.Now().UnixNano())
-	r1 := rand.New(s1)
-	// r2 := rand.New(s1)
-
-	var population populationType
-	globalStats = globalStatsStruct{}
-
-	population.initialize()
-
-	mainParameters.TotalPopulation = populationSpaceDimension * populationSpaceDimension
+// finished tells whether the epidemic is over: nobody is sick, and no case may come from outside.
+// The recovered losing their immunity are still followed, but they can't start it again.
+func (s *simulation) finished() bool {
+	g := s.globalStats
+	return g.totalInfected+g.totalAsymptomatic+g.totalIll+g.totalHospitalized+g.totalICU == 0 && !s.importing()
+}
 
-	globalStats.totalIntact = mainParameters.TotalPopulation
+func (s *simulation) run() {
+	for !s.finished() {
+		s.stepDay()
 
-	var pArrayOfSick []personID
+		if s.checkpointEvery > 0 && s.globalStats.daysCount%s.checkpointEvery == 0 {
+			fn := s.checkpointFile
+			if strings.Contains(fn, "%") {
+				fn = fmt.Sprintf(fn, s.globalStats.daysCount)
+			}
+			checkError("Cannot write checkpoint: ", s.saveCheckpoint(fn))
+			if s.verbose {
+				fmt.Printf("Day %v. Checkpoint saved to %v\n", s.globalStats.daysCount, fn)
+			}
+		}
+	}
+}
 
-	// a random person gets ill
-	iVeryFirstInfected := r1.Intn(populationSpaceDimension)
-	jVeryFirstInfected := r1.Intn(populationSpaceDimension)
+// stepDay advances the simulation by a single day in two phases: first every transition is
+// collected from the population as it was in the morning, then they are all applied at once,
+// so nobody infected today passes the disease on or progresses before tomorrow
+func (s *simulation) stepDay() {
+	switch s.parameters.Engine {
+	case "parallel":
+		s.stepDayParallel()
+		return
+	case "events":
+		s.stepDayEvents()
+		return
+	}
 
-	population[iVeryFirstInfected][jVeryFirstInfected].state = personState.Ill
-	population[iVeryFirstInfected][jVeryFirstInfected].daysInState = 1
+	s.beginDay()
 
-	pArrayOfSick = append(pArrayOfSick, population[iVeryFirstInfected][jVeryFirstInfected].personID)
+	collected := s.collectTransitions(s.population, s.arrayOfSick, s.r1)
+	s.applyTransitions([]transitions{collected})
 
-	globalStats.totalIll++
-	globalStats.totalIntact--
+	s.endDay()
+}
 
-	file, err := os.Create("result.csv")
-	checkError("Cannot create file", err)
-	defer file.Close()
+// beginDay moves the calendar forward and sets the day's conditions, whatever engine is stepping
+func (s *simulation) beginDay() {
+	if s.globalStats.daysCount/365 > s.yearsPassed {
+		s.yearsPassed++
+		//update population age
+		if s.verbose {
+			fmt.Printf("Year %v passed\n", s.yearsPassed)
+		}
+		if s.demographics != nil {
+			s.takePyramid(s.yearsPassed)
+		} else {
+			s.population.growAYear()
+		}
+	}
 
-	dailyProgressLog := csv.NewWriter(file)
-	defer dailyProgressLog.Flush()
+	s.globalStats.daysCount++
+	s.population.tickNextDay()
+	if s.demographics != nil {
+		s.demographicsDay()
+	}
 
-	dailyProgressLog.Write([]string{"Day", "Dead", "Ill", "Infected", "Recovered", "Hospitalized", "On ICU", "Healthcare capacity", "Current mortality rate", "Self-isolated"})
-	line := []string{
-		fmt.Sprintf("%v", globalStats.daysCount),
-		fmt.Sprintf("%v", globalStats.totalDead),
-		fmt.Sprintf("%v", globalStats.totalIll),
-		fmt.Sprintf("%v", globalStats.totalInfected),
-		fmt.Sprintf("%v", globalStats.totalRecovered),
-		fmt.Sprintf("%v", globalStats.totalHospitalized),
-		fmt.Sprintf("%v", globalStats.totalICU),
-		fmt.Sprintf("%v", mainParameters.HealthcareCapacity),
-		fmt.Sprintf("%v", globalStats.currentMortality),
-		fmt.Sprintf("%v", globalStats.totalSelfIsolated),
+	if s.globalStats.totalHospitalized+s.globalStats.totalICU >= s.globalStats.healthcareCapacity {
+		s.globalStats.currentMortality = s.parameters.MortalityRate * 2
+	} else {
+		s.globalStats.currentMortality = s.parameters.MortalityRate
 	}
-	dailyProgressLog.Write(line)
+	s.updateVigilance()
+	s.updateUptakes()
+	s.deliverTreatments()
 
-	yearsPassed := 0
+	if enableDebugMessages {
+		fmt.Printf("%v\n", s.globalStats)
+	}
+}
 
-	var totalQuarantineAppliedAppliedOnPreviousDay = false
+// endDay brings in the imported cases, releases the isolated, applies the population-wide policies and records the day
+func (s *simulation) endDay() {
+	if s.importation != nil {
+		s.importDay()
+	}
+	s.endIsolations()
+	s.healthcareDay()
 
-	// step over
-	for globalStats.totalInfected+globalStats.totalIll > 0 {
+	s.globalStats.totalQuarantineApplied = (((s.globalStats.totalIll + s.globalStats.totalDead) * 100 / s.parameters.TotalPopulation) > s.parameters.TotalQuarantineAppliedTreshold)
 
-		if globalStats.daysCount/365 > yearsPassed {
-			yearsPassed++
-			//update population age
-			fmt.Printf("Year %v passed\n", yearsPassed)
-			population.growAYear()
+	switch {
+	case s.globalStats.totalQuarantineApplied && !s.totalQuarantineAppliedAppliedOnPreviousDay:
+		s.totalQuarantineAppliedAppliedOnPreviousDay = true
+		if s.verbose {
+			fmt.Printf("Day %v. Total quarantine applied\n", s.globalStats.daysCount)
 		}
-
-		globalStats.daysCount++
-		population.tickNextDay()
-
-		// TODO: healthcare
-		if globalStats.totalInfected >= mainParameters.HealthcareCapacity {
-			globalStats.currentMortality = mainParameters.MortalityRate * 2
-		} else {
-			globalStats.currentMortality = mainParameters.MortalityRate
+	case !s.globalStats.totalQuarantineApplied && s.totalQuarantineAppliedAppliedOnPreviousDay:
+		s.totalQuarantineAppliedAppliedOnPreviousDay = false
+		if s.verbose {
+			fmt.Printf("Day %v. Total quarantine dismissed\n", s.globalStats.daysCount)
 		}
+	}
 
-		if enableDebugMessages {
-			fmt.Printf("%v\n", globalStats)
-		}
+	s.history = append(s.history, s.globalStats)
+}
+
+// simulationSummary condenses a finished run into a handful of outcomes
+type simulationSummary struct {
+	days         int
+	dead         int
+	recovered    int
+	peakIll      int
+	peakIllDay   int
+	attackRate   float64 // share of the population ever infected, %
+	selfIsolated int
+	offspring    offspringStatistics
+}
 
-		s1 := rand.NewSource(time.Now().UnixNano())
-		r1 := rand.New(s1)
+func (s *simulation) summary() simulationSummary {
+	result := simulationSummary{
+		days:         s.globalStats.daysCount,
+		dead:         s.globalStats.totalDead,
+		recovered:    s.globalStats.totalRecovered,
+		selfIsolated: s.globalStats.totalSelfIsolated,
+	}
 
-		for index, element := range pArrayOfSick {
-			//1. take a person
-			person := &population[element[0]][element[1]]
+	for _, day := range s.history {
+		if day.totalIll > result.peakIll {
+			result.peakIll = day.totalIll
+			result.peakIllDay = day.daysCount
+		}
+	}
 
-			// FIXME: days in state must be calculated for all citizens
-			// person.daysInState++
+	result.offspring = s.offspringStatistics()
 
-			if enableDebugMessages {
-				fmt.Printf("Person [%v] already %v days in state %v\n", person.personID, person.daysInState, person.state)
-			}
+	if s.parameters.TotalPopulation > 0 {
+		result.attackRate = float64(s.parameters.TotalPopulation-s.globalStats.totalIntact) * 100 / float64(s.parameters.TotalPopulation)
+	}
 
-			switch person.state {
-			// if a person is either recovered or dead, do nothing
-			case personState.Recovered:
-				//do nothing
-				if enableDebugMessages {
-					fmt.Printf("Person [%v] already recovered. Skipping\n", person.personID)
-				}
-			case personState.Dead:
-				//do nothing
-				if enableDebugMessages {
-					fmt.Printf("Person [%v] already dead. Skipping\n", person.personID)
-				}
-			default:
-				switch {
-				case globalStats.totalQuarantineApplied:
-					//if total strict quarantine applied: no contacts allowed
-					break
-				case person.selfIsolated && (r1.Intn(100) <= mainParameters.SelfIsolationStrictness):
-					//if a person self-isolated, it have no contacts
-					break
-				}
-				// no quarantine, no self-quarantine:
-				//2. get neighbours
-				neighboursArray := population.getContacted(*person, mainParameters.MaximumTravelRange, mainParameters.MaximumContactsPerDay)
-				for _, contactElement := range neighboursArray {
-					contact := &population[contactElement[0]][contactElement[1]]
-
-					if contact.selfIsolated && (r1.Intn(100) <= mainParameters.SelfIsolationStrictness) {
-						break
-					}
-
-					switch contact.state {
-					//3. calculate a chance to infect each of them
-					//3.1 leave recovered and dead intact
-					case personState.Recovered:
-						// do nothing
-					case personState.Dead:
-						//do nothing
-					default:
-						//person.ill or person.susceptible and contact.healthy
-						switch {
-						case ((person.state == personState.Ill) || (person.state == personState.Susceptible)) && (contact.state == personState.Healthy):
-							if r1.Intn(100) <= mainParameters.TransitionRate {
-								contact.state = personState.Susceptible
-								contact.daysInState = 1
-								globalStats.totalInfected++
-								globalStats.totalIntact--
-
-								pArrayOfSick = append(pArrayOfSick, contact.personID)
-
-								if enableDebugMessages {
-									fmt.Println("Contacted person", contact.personID, " gets infected")
-								}
-
-							}
-						//vise versa: contact.ill or contact.Susceptible and person.healthy
-						case ((contact.state == personState.Ill) || (contact.state == personState.Susceptible)) && (person.state == personState.Healthy):
-							if r1.Intn(100) <= mainParameters.TransitionRate {
-								person.state = personState.Susceptible
-								person.daysInState = 1
-								globalStats.totalInfected++
-								globalStats.totalIntact--
-
-								pArrayOfSick = append(pArrayOfSick, person.personID)
-
-								if enableDebugMessages {
-									fmt.Println("Person [", person.personID, "] gets infected after contact")
-								}
-							}
-						default:
-							// do nothing
-						}
-					}
-
-				}
-				//3.2 if a person is ill or infected
-				switch {
-				// get a chance to die
-				case (person.state == personState.Ill) && (r1.Intn(100) <= globalStats.currentMortality):
-					person.state = personState.Dead
-					globalStats.totalDead++
-					globalStats.totalIll--
-
-					pArrayOfSick = removeSick(pArrayOfSick, index)
-
-					if enableDebugMessages {
-						fmt.Printf("Person [%v] dies after %v days\n", person.personID, person.daysInState)
-					}
-				//get a chance to get ill
-				case (person.state == personState.Susceptible) && (person.daysInState >= mainParameters.GrayPeriod):
-					if r1.Intn(100) <= mainParameters.InfectionRate {
-						if enableDebugMessages {
-							fmt.Printf("Person [%v] gets ill after %v days\n", person.personID, person.daysInState)
-						}
-
-						person.state = personState.Ill
-						person.daysInState = 1
-
-						// self-isolate
-						if r1.Intn(100) <= mainParameters.SelfIsolationRate {
-							person.selfIsolated = true
-							globalStats.totalSelfIsolated++
-						}
-
-						globalStats.totalIll++
-						globalStats.totalInfected--
-
-					}
-				//get a chance to recover
-				case (person.state == personState.Ill) && (person.daysInState >= mainParameters.DaysBeforeSelfRecovery):
-					if r1.Intn(100) <= mainParameters.SelfRecoveryRate/2 {
-						if enableDebugMessages {
-							fmt.Printf("Person [%v] recovers after %v days of illness\n", person.personID, person.daysInState)
-						}
-
-						person.state = personState.Recovered
-						person.daysInState = 1
-
-						pArrayOfSick = removeSick(pArrayOfSick, index)
-						globalStats.totalIll--
-						globalStats.totalRecovered++
-					}
-				//get a chance to get sick
-				case (person.state == personState.Susceptible) && (person.daysInState >= mainParameters.GrayPeriod):
-					if r1.Intn(100) <= mainParameters.InfectionRate {
-						if enableDebugMessages {
-							fmt.Printf("Person [%v] gets ill after %v days of being infected\n", person.personID, person.daysInState)
-						}
-
-						person.state = personState.Ill
-						person.daysInState = 1
-
-						globalStats.totalInfected--
-						globalStats.totalIll++
-					}
-
-				case (person.state == personState.Susceptible) && (person.daysInState >= mainParameters.DaysBeforeSelfRecovery):
-					if r1.Intn(100) <= mainParameters.SelfRecoveryRate {
-						if enableDebugMessages {
-							fmt.Printf("Person [%v] recovers after %v days of being infected\n", person.personID, person.daysInState)
-						}
-
-						person.state = personState.Recovered
-						person.daysInState = 1
-
-						pArrayOfSick = removeSick(pArrayOfSick, index)
-						globalStats.totalRecovered++
-						globalStats.totalInfected--
-					}
-				//stay at current condition one more day
-				default:
-					// do nothing
-				}
+	return result
+}
 
-			}
-		}
+var dailyProgressHeader = []string{"Day", "Dead", "Ill", "Infected", "Recovered", "Hospitalized", "On ICU", "Healthcare capacity", "Current mortality rate", "Self-isolated", "Asymptomatic", "Births", "Natural deaths", "Date", "Transmission multiplier", "Day type", "Imported infections", "Local infections",
+	"Mask uptake", "Distancing uptake", "Infections averted by masks", "Infections averted by distancing",
+	"Reported deaths per 1000", "Vigilance", "Currently isolated", "Treatment courses",
+	"Healthcare workers missing", "Healthcare worker infections"}
 
-		globalStats.totalQuarantineApplied = (((globalStats.totalIll + globalStats.totalDead) * 100 / mainParameters.TotalPopulation) > mainParameters.TotalQuarantineAppliedTreshold)
+func (s *simulation) writeDailyProgress(fn string) {
+	file, err := os.Create(fn)
+	checkError("Cannot create file", err)
+	defer file.Close()
 
-		switch {
-		case globalStats.totalQuarantineApplied && !totalQuarantineAppliedAppliedOnPreviousDay:
-			totalQuarantineAppliedAppliedOnPreviousDay = true
-			fmt.Printf("Day %v. Total quarantine applied\n", globalStats.daysCount)
-		case !globalStats.totalQuarantineApplied && totalQuarantineAppliedAppliedOnPreviousDay:
-			totalQuarantineAppliedAppliedOnPreviousDay = false
-			fmt.Printf("Day %v. Total quarantine dismissed\n", globalStats.daysCount)
-		}
+	dailyProgressLog := csv.NewWriter(file)
+	defer dailyProgressLog.Flush()
 
+	dailyProgressLog.Write(dailyProgressHeader)
+	for _, globalStats := range s.history {
 		line := []string{
 			fmt.Sprintf("%v", globalStats.daysCount),
 			fmt.Sprintf("%v", globalStats.totalDead),
 			fmt.Sprintf("%v", globalStats.totalIll),
 			fmt.Sprintf("%v", globalStats.totalInfected),
 			fmt.Sprintf("%v", globalStats.totalRecovered),
-			fmt.Sprintf("%v", mainParameters.HealthcareCapacity),
+			fmt.Sprintf("%v", globalStats.totalHospitalized),
+			fmt.Sprintf("%v", globalStats.totalICU),
+			fmt.Sprintf("%v", globalStats.healthcareCapacity),
 			fmt.Sprintf("%v", globalStats.currentMortality),
 			fmt.Sprintf("%v", globalStats.totalSelfIsolated),
+			fmt.Sprintf("%v", globalStats.totalAsymptomatic),
+			fmt.Sprintf("%v", globalStats.totalBirths),
+			fmt.Sprintf("%v", globalStats.totalNaturalDeaths),
+			s.calendar.date(globalStats.daysCount).Format(dateLayout),
+			fmt.Sprintf("%.3f", s.transmissionMultiplier(globalStats.daysCount)),
+			dayTypeNames[s.calendar.dayType(globalStats.daysCount)],
+			fmt.Sprintf("%v", globalStats.totalImported),
+			fmt.Sprintf("%v", globalStats.totalLocal),
+			fmt.Sprintf("%v", globalStats.uptake[behaviourMasks]),
+			fmt.Sprintf("%v", globalStats.uptake[behaviourDistancing]),
+			fmt.Sprintf("%v", globalStats.averted[behaviourMasks]),
+			fmt.Sprintf("%v", globalStats.averted[behaviourDistancing]),
+			fmt.Sprintf("%.3f", globalStats.reportedDeaths),
+			fmt.Sprintf("%.3f", 1-globalStats.fatigue),
+			fmt.Sprintf("%v", globalStats.currentlyIsolated),
+			fmt.Sprintf("%v", globalStats.totalTreatmentCourses()),
+			fmt.Sprintf("%v", globalStats.healthcareWorkersMissing),
+			fmt.Sprintf("%v", globalStats.healthcareInfections),
 		}
 		dailyProgressLog.Write(line)
+	}
+}
+
+func main() {
+	configFile := flag.String("config", "config.json", "simulation parameters")
+	sweepFile := flag.String("sweep", "", "run a parameter sweep described in the given file instead of a single simulation")
+	sensitivityFile := flag.String("sensitivity", "", "run a global sensitivity analysis described in the given file")
+	calibrationFile := flag.String("calibrate", "", "fit parameters to an observed series as described in the given file")
+	odeFile := flag.String("ode", "", "solve the deterministic compartmental model instead and write it to the given file")
+	checkpointFile := flag.String("checkpoint", "checkpoint.gob", "checkpoint file, may contain a %v verb for the day number")
+	checkpointEvery := flag.Int("checkpoint-every", 0, "save a checkpoint every given number of days")
+	resumeFile := flag.String("resume", "", "continue the simulation saved in the given checkpoint")
+	forkFile := flag.String("fork", "", "when resuming, override the checkpointed parameters with the ones in the given file")
+	benchmarkSizes := flag.String("benchmark", "", "measure memory and step time for a comma-separated list of population sizes")
+	benchmarkDays := flag.Int("benchmark-days", 30, "days simulated per benchmark")
+	flag.Parse()
+
+	mainParameters = loadParameters(*configFile)
+
+	if *sweepFile != "" {
+		runSweep(*sweepFile, mainParameters)
+		return
+	}
+
+	if *sensitivityFile != "" {
+		runSensitivity(*sensitivityFile, mainParameters)
+		return
+	}
+
+	if *calibrationFile != "" {
+		runCalibration(*calibrationFile, mainParameters)
+		return
+	}
+
+	if *benchmarkSizes != "" {
+		runBenchmark(*benchmarkSizes, *benchmarkDays, mainParameters)
+		return
+	}
+
+	if *odeFile != "" {
+		runODE(*odeFile, mainParameters)
+		return
+	}
 
+	//FIXME: find out how to set a range dynamically
+	// const count = int(math.Floor(math.Sqrt(float64(mainParameters.TotalPopulation))))
+
+	//initialize
+	var s *simulation
+	if *resumeFile != "" {
+		var err error
+		s, err = loadCheckpoint(*resumeFile)
+		checkError("Cannot resume: ", err)
+		if *forkFile != "" {
+			s.fork(*forkFile)
+		}
+		fmt.Printf("Day %v. Resumed from %v\n", s.globalStats.daysCount, *resumeFile)
+	} else {
+		s = newSimulation(mainParameters)
 	}
+	s.verbose = true
+	s.checkpointFile = *checkpointFile
+	s.checkpointEvery = *checkpointEvery
+
+	// step over
+	s.run()
 
-	population.logPopulation()
+	s.writeDailyProgress("result.csv")
+	if s.demographics != nil {
+		s.writePyramids("pyramid.csv")
+	}
+	s.population.logPopulation()
 
-	fmt.Println(globalStats)
+	fmt.Println(s.globalStats)
+	fmt.Println(s.offspringStatistics())
+	s.logRiskGroups()
+	s.logTreatments()
 	fmt.Println("End of sumilation")
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+)
+
+// The mean-field companion of the agent-based model: the population is split into
+// S (healthy), E (susceptible = exposed), I (ill), H (under treatment), C (ICU), R (recovered) and D (dead)
+// compartments, whose sizes are evolved with a classic 4th order Runge-Kutta scheme.
+
+const (
+	odeStepsPerDay  = 10
+	odeMaximumDays  = 3650
+	odeHospitalStay = 7.5 // days, severe cases: 7-8D hospitalization
+	odeICUStay      = 8.5 // days, critical cases: 8-9D ICU
+)
+
+type compartments struct{ S, E, I, H, C, R, D float64 }
+
+func (a compartments) add(b compartments, t float64) compartments {
+	return compartments{a.S + t*b.S, a.E + t*b.E, a.I + t*b.I, a.H + t*b.H, a.C + t*b.C, a.R + t*b.R, a.D + t*b.D}
+}
+
+// odeParameters are the rates (per day) of the flows between compartments
+type odeParameters struct {
+	population float64
+
+	betaExposed, betaIll, betaHospitalized, betaICU float64 // S -> E
+
+	incubation float64 // E -> I
+	recovery   float64 // I -> R
+	mortality  float64 // I -> D, doubled once HealthcareCapacity is exceeded
+	admission  float64 // I -> H
+	icuShare   float64 // share of H moving on to C, the rest recovers
+	capacity   float64
+	seasonal   float64 // transmission multiplier of the day being integrated
+}
+
+// chanceOf is the probability behind the agent engine's "r1.Float64()*100 < rate" test
+func chanceOf(rate float64) float64 {
+	return math.Max(0, math.Min(1, rate/100))
+}
+
+// dailyRate turns the probability of leaving a state within a day into a continuous rate
+func dailyRate(probability float64) float64 {
+	if probability >= 1 {
+		return math.Inf(1)
+	}
+	return -math.Log(1 - probability)
+}
+
+// meanDwellRate is the inverse of the mean time spent in a state left with a daily probability
+// once the citizen has been there for a given number of days
+func meanDwellRate(days int, probability float64) float64 {
+	if probability <= 0 {
+		return 0
+	}
+	return 1 / (math.Max(float64(days-1), 0) + 1/probability)
+}
+
+// deriveODEParameters follows the agents' transition table: only the states the agents pass the
+// disease on from transmit, and the ill are admitted to hospital and ICU only when rules lead there
+func deriveODEParameters(parameters mainParametersStruct) odeParameters {
+	table, err := compileTransitions(&parameters)
+	checkError("Invalid model: ", err)
+
+	neighbours := float64((2*parameters.MaximumTravelRange+1)*(2*parameters.MaximumTravelRange+1) - 1)
+	transmission := chanceOf(float64(parameters.TransitionRate))
+	beta := func(state State) float64 {
+		if !state.infectious() {
+			return 0
+		}
+		contacts := math.Min(float64(parameters.MaximumContactsPerDay)*parameters.contactsPerDayModifiers[state], neighbours)
+		return contacts * transmission
+	}
+
+	o := odeParameters{
+		population:       float64(parameters.dimension() * parameters.dimension()),
+		betaExposed:      beta(StateSusceptible),
+		betaIll:          beta(StateIll),
+		betaHospitalized: beta(StateUnderTreatment),
+		betaICU:          beta(StateICU),
+		incubation:       meanDwellRate(parameters.GrayPeriod, chanceOf(float64(parameters.InfectionRate))),
+		recovery:         meanDwellRate(parameters.DaysBeforeSelfRecovery, chanceOf(float64(parameters.SelfRecoveryRate)/2)),
+		mortality:        dailyRate(chanceOf(float64(parameters.MortalityRate))),
+		capacity:         float64(parameters.HealthcareCapacity),
+		seasonal:         1,
+	}
+
+	// severe and critical cases are admitted, chosen so that they make up their share of all the ill
+	total := 0.0
+	for _, share := range parameters.SeverityLevelsDistribution {
+		total += share
+	}
+	severe := parameters.SeverityLevelsDistribution["Severe"]
+	critical := parameters.SeverityLevelsDistribution["Critical"]
+	hospitalizedShare := (severe + critical) / total
+	if table.leads(StateIll, StateUnderTreatment) && hospitalizedShare > 0 && hospitalizedShare < 1 {
+		o.admission = hospitalizedShare * (o.recovery + o.mortality) / (1 - hospitalizedShare)
+		if table.leads(StateUnderTreatment, StateICU) {
+			o.icuShare = critical / (severe + critical)
+		}
+	}
+
+	// a sampled incubation time replaces the threshold and the daily chance
+	if incubation, ok := parameters.Dwell[StateSusceptible]; ok && incubation.mean() > 0 {
+		o.incubation = 1 / incubation.mean()
+	}
+
+	return o
+}
+
+// derivatives follows the agent engine in doubling mortality once the hospitalized outnumber the healthcare capacity
+func (o odeParameters) derivatives(y compartments) compartments {
+	force := o.seasonal * (o.betaExposed*y.E + o.betaIll*y.I + o.betaHospitalized*y.H + o.betaICU*y.C) / o.population
+	mortality := o.mortality
+	if y.H+y.C >= o.capacity {
+		mortality *= 2
+	}
+
+	infections := force * y.S
+	onsets := o.incubation * y.E
+	recoveries := o.recovery * y.I
+	deaths := mortality * y.I
+	admissions := o.admission * y.I
+	discharges := y.H / odeHospitalStay
+	icuDeaths := y.C / odeICUStay
+
+	return compartments{
+		S: -infections,
+		E: infections - onsets,
+		I: onsets - recoveries - deaths - admissions,
+		H: admissions - discharges,
+		C: o.icuShare*discharges - icuDeaths,
+		R: recoveries + (1-o.icuShare)*discharges,
+		D: deaths + icuDeaths,
+	}
+}
+
+func (o odeParameters) rungeKuttaStep(y compartments, h float64) compartments {
+	k1 := o.derivatives(y)
+	k2 := o.derivatives(y.add(k1, h/2))
+	k3 := o.derivatives(y.add(k2, h/2))
+	k4 := o.derivatives(y.add(k3, h))
+	return y.add(k1, h/6).add(k2, h/3).add(k3, h/3).add(k4, h/6)
+}
+
+// solveODE integrates from a single ill citizen until fewer than one citizen is left infectious,
+// transmission following the seasons of the calendar
+func solveODE(parameters mainParametersStruct) []compartments {
+	o := deriveODEParameters(parameters)
+	y := compartments{S: o.population - 1, I: 1}
+
+	days, err := compileCalendar(&parameters)
+	checkError("Invalid model: ", err)
+	seasonality, err := compileSeasonality(parameters.Seasonality)
+	checkError("Invalid model: ", err)
+
+	trajectory := []compartments{y}
+	for day := 1; day <= odeMaximumDays && y.E+y.I+y.H+y.C >= 0.5; day++ {
+		o.seasonal = seasonality.multiplier(days.date(day))
+		for step := 0; step < odeStepsPerDay; step++ {
+			y = o.rungeKuttaStep(y, 1.0/odeStepsPerDay)
+		}
+		trajectory = append(trajectory, y)
+	}
+	return trajectory
+}
+
+// runODE writes the compartment sizes in the result.csv layout so both models can be plotted together
+func runODE(fn string, parameters mainParametersStruct) {
+	o := deriveODEParameters(parameters)
+	trajectory := solveODE(parameters)
+	days, _ := compileCalendar(&parameters)
+	seasonality, _ := compileSeasonality(parameters.Seasonality)
+
+	file, err := os.Create(fn)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	odeLog := csv.NewWriter(file)
+	defer odeLog.Flush()
+
+	odeLog.Write(dailyProgressHeader)
+	for day, y := range trajectory {
+		mortality := parameters.MortalityRate
+		if day > 0 && y.H+y.C >= o.capacity {
+			mortality *= 2
+		}
+		row := []string{
+			fmt.Sprintf("%v", day),
+			fmt.Sprintf("%.2f", y.D),
+			fmt.Sprintf("%.2f", y.I),
+			fmt.Sprintf("%.2f", y.E),
+			fmt.Sprintf("%.2f", y.R),
+			fmt.Sprintf("%.2f", y.H),
+			fmt.Sprintf("%.2f", y.C),
+			fmt.Sprintf("%v", parameters.HealthcareCapacity),
+			fmt.Sprintf("%v", mortality),
+			fmt.Sprintf("%v", 0),
+			"", "", "", // no asymptomatic pathway nor demographics
+			days.date(day).Format(dateLayout),
+			fmt.Sprintf("%.3f", seasonality.multiplier(days.date(day))),
+			dayTypeNames[days.dayType(day)],
+		}
+		// the columns that follow describe the agents alone, left empty
+		odeLog.Write(append(row, make([]string, len(dailyProgressHeader)-len(row))...))
+	}
+
+	last := trajectory[len(trajectory)-1]
+	fmt.Printf("Day: %v\nDead: %.0f\nRecovered: %.0f\nIntact: %.0f\n", len(trajectory)-1, last.D, last.R, last.S)
+	fmt.Printf("Compartmental model written to %v\n", fn)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestDeriveODEParameters(t *testing.T) {
+	// the default course never goes to hospital, the agents in hospital and ICU don't transmit
+	o := deriveODEParameters(loadParameters("config.json"))
+	if o.admission != 0 || o.icuShare != 0 {
+		t.Errorf("admission %v and ICU share %v without rules leading to hospital", o.admission, o.icuShare)
+	}
+	if o.betaHospitalized != 0 || o.betaICU != 0 || o.betaExposed == 0 || o.betaIll == 0 {
+		t.Errorf("betas %v, %v, %v and %v", o.betaExposed, o.betaIll, o.betaHospitalized, o.betaICU)
+	}
+
+	o = deriveODEParameters(loadParameters("hospital.json"))
+	if o.admission == 0 || o.icuShare == 0 {
+		t.Errorf("admission %v and ICU share %v with rules leading to hospital and ICU", o.admission, o.icuShare)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Every citizen can be given an individual infectiousness, drawn at infection from a gamma
+// distribution of mean 1 and shape InfectiousnessDispersion (k). The smaller k, the more the
+// infections are due to a few superspreaders. The offspring distribution - how many citizens
+// each case passed the disease on to - is reported at the end of the run.
+
+// offspringStatistics summarise the offspring distribution of the cases of a run
+type offspringStatistics struct {
+	cases      int     // citizens ever infected
+	mean       float64 // close to 1 once the epidemic is over
+	early      float64 // mean offspring of the cases infected before the peak of ill citizens
+	variance   float64
+	dispersion float64 // k of the negative binomial of that mean and variance, +Inf when not overdispersed
+	none       float64 // share of the cases who infected nobody
+	top20      float64 // share of the infections caused by the most infectious 20% of the cases
+	max        int
+}
+
+func (s *simulation) offspringStatistics() (result offspringStatistics) {
+	peakIll, peakIllDay := 0, 0
+	for _, day := range s.history {
+		if day.totalIll > peakIll {
+			peakIll, peakIllDay = day.totalIll, day.daysCount
+		}
+	}
+
+	var counts []int
+	earlyCases, earlyTotal := 0, 0
+	for index, state := range s.population.state {
+		if state == StateHealthy || state == StateVacant {
+			continue
+		}
+		count := s.offspring[personIndex(index)]
+		counts = append(counts, count)
+		if s.globalStats.daysCount-s.population.citizen(personIndex(index)).daysInfected < peakIllDay {
+			earlyCases++
+			earlyTotal += count
+		}
+	}
+	if earlyCases > 0 {
+		result.early = float64(earlyTotal) / float64(earlyCases)
+	}
+	result.cases = len(counts)
+	if result.cases == 0 {
+		return
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+	result.max = counts[0]
+
+	total := 0
+	for _, count := range counts {
+		total += count
+		if count == 0 {
+			result.none++
+		}
+	}
+	result.none /= float64(result.cases)
+	result.mean = float64(total) / float64(result.cases)
+
+	for _, count := range counts {
+		result.variance += (float64(count) - result.mean) * (float64(count) - result.mean)
+	}
+	result.variance /= float64(result.cases)
+
+	result.dispersion = math.Inf(1)
+	if result.variance > result.mean {
+		result.dispersion = result.mean * result.mean / (result.variance - result.mean)
+	}
+
+	if total > 0 {
+		top, top20 := int(math.Ceil(float64(result.cases)*0.2)), 0
+		for _, count := range counts[:top] {
+			top20 += count
+		}
+		result.top20 = float64(top20) / float64(total)
+	}
+	return
+}
+
+func (o offspringStatistics) String() string {
+	return fmt.Sprintf("Cases: %v\nMean offspring: %.3f\nMean offspring before the peak: %.3f\nOffspring variance: %.3f\nOffspring dispersion (k): %.3f\nCases infecting nobody: %.1f%%\nInfections by the top 20%% of cases: %.1f%%\nLargest offspring: %v",
+		o.cases, o.mean, o.early, o.variance, o.dispersion, o.none*100, o.top20*100, o.max)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// The parallel engine splits the grid into square tiles handled by a pool of workers.
+// During the collect phase workers only read the population as it was at the start of the day;
+// their transitions (infections may cross tile borders) are then applied in tile order.
+// Every tile draws from its own stream derived from the seed, the day and the tile index,
+// which keeps runs reproducible whatever the number of workers.
+
+const defaultTileSize = 10
+
+// tileSeed mixes the run seed, the day and the tile index (splitmix64 finaliser)
+func tileSeed(seed int64, day, tile int) int64 {
+	z := uint64(seed) + uint64(day)*0x9E3779B97F4A7C15 + uint64(tile)*0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return int64(z ^ (z >> 31))
+}
+
+func (s *simulation) tileSize() int {
+	if s.parameters.TileSize <= 0 {
+		return defaultTileSize
+	}
+	return s.parameters.TileSize
+}
+
+func (s *simulation) tileOf(index personIndex) int {
+	size := s.tileSize()
+	tilesPerRow := (s.population.dimension + size - 1) / size
+	id := s.population.id(index)
+	return id[0]/size*tilesPerRow + id[1]/size
+}
+
+// stepDayParallel is the tiled counterpart of stepDay
+func (s *simulation) stepDayParallel() {
+	s.beginDay()
+
+	size := s.tileSize()
+	tilesPerRow := (s.population.dimension + size - 1) / size
+	tiles := make([][]personIndex, tilesPerRow*tilesPerRow)
+	for _, element := range s.arrayOfSick {
+		tile := s.tileOf(element)
+		tiles[tile] = append(tiles[tile], element)
+	}
+	for _, sick := range tiles {
+		sort.Slice(sick, func(i, j int) bool { return sick[i] < sick[j] })
+	}
+
+	workers := s.parameters.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	collected := make([]transitions, len(tiles))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range queue {
+				r1 := rand.New(rand.NewSource(tileSeed(s.source.seed, s.globalStats.daysCount, tile)))
+				collected[tile] = s.collectTransitions(s.population, tiles[tile], r1)
+			}
+		}()
+	}
+	for tile, sick := range tiles {
+		if len(sick) > 0 {
+			queue <- tile
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	s.applyTransitions(collected)
+
+	s.endDay()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+)
+
+// The population is stored as a structure of arrays: one packed slice per citizen attribute,
+// indexed by personIndex. A citizen takes 19 bytes instead of the 80-odd of the citizen struct,
+// which leaves room for tens of millions of them. The citizen struct remains the unit the model
+// logic works with, copied in and out through the accessors below.
+
+const defaultPopulationSpaceDimension = 50
+
+// personIndex is the compact form of personID: row * dimension + column
+type personIndex int32
+
+type populationType struct {
+	dimension        int
+	today            uint16 // days since the start, modulo 65536
+	state            []State
+	entered          []uint16 // the day before the citizen entered their state, modulo 65536
+	infected         []uint16 // the day the citizen caught the disease, modulo 65536
+	dwell            []uint16
+	infectiousness   []float32
+	selfIsolated     []bool
+	isolatedSince    []uint16 // the day before the citizen's isolation began, modulo 65536
+	hospitality      []uint8
+	sicknessSeverity []uint8
+	age              []uint8
+	riskFactors      []uint8
+	vaccinated       []bool
+	birthday         []uint16            // allocated with demographics only
+	adherence        [behaviours][]uint8 // allocated for the behaviours of the run only
+	treatments       []uint8             // allocated with treatments only
+	onset            []uint16            // the day before the citizen's symptoms showed up, modulo 65536; allocated with treatments only
+	healthcareWorker []bool              // allocated with healthcare workers only
+}
+
+func newPopulation(dimension int) *populationType {
+	n := dimension * dimension
+	return &populationType{
+		dimension:        dimension,
+		state:            make([]State, n),
+		entered:          make([]uint16, n),
+		infected:         make([]uint16, n),
+		dwell:            make([]uint16, n),
+		infectiousness:   make([]float32, n),
+		selfIsolated:     make([]bool, n),
+		isolatedSince:    make([]uint16, n),
+		hospitality:      make([]uint8, n),
+		sicknessSeverity: make([]uint8, n),
+		age:              make([]uint8, n),
+		riskFactors:      make([]uint8, n),
+		vaccinated:       make([]bool, n),
+	}
+}
+
+// dimension is the side of the square grid the citizens live on
+func (parameters *mainParametersStruct) dimension() int {
+	if parameters.PopulationSpaceDimension <= 0 {
+		return defaultPopulationSpaceDimension
+	}
+	return parameters.PopulationSpaceDimension
+}
+
+func (p *populationType) size() int {
+	return len(p.state)
+}
+
+func (p *populationType) index(id personID) personIndex {
+	return personIndex(id[0]*p.dimension + id[1])
+}
+
+func (p *populationType) id(index personIndex) personID {
+	return personID{int(index) / p.dimension, int(index) % p.dimension}
+}
+
+func (p *populationType) stateOf(index personIndex) State {
+	return p.state[index]
+}
+
+func (p *populationType) citizen(index personIndex) citizen {
+	return citizen{
+		state:            p.state[index],
+		daysInState:      p.daysInState(index),
+		daysInfected:     int(p.today - p.infected[index]),
+		dwell:            int(p.dwell[index]),
+		infectiousness:   float64(p.infectiousness[index]),
+		selfIsolated:     p.selfIsolated[index],
+		daysIsolated:     p.daysIsolated(index),
+		hospitality:      int(p.hospitality[index]),
+		sicknessSeverity: int(p.sicknessSeverity[index]),
+		age:              int(p.age[index]),
+		riskFactors:      p.riskFactors[index],
+		vaccinated:       p.vaccinated[index],
+		birthday:         p.birthdayOf(index),
+		adherence:        p.adherenceOf(index),
+		treatments:       p.treatmentsOf(index),
+		daysSinceOnset:   p.daysSinceOnset(index),
+		healthcareWorker: p.healthcareWorker != nil && p.healthcareWorker[index],
+		personID:         p.id(index),
+	}
+}
+
+func (p *populationType) setCitizen(c citizen) {
+	index := p.index(c.personID)
+	p.state[index] = c.state
+	p.entered[index] = p.today - saturatedUint16(c.daysInState)
+	p.infected[index] = p.today - saturatedUint16(c.daysInfected)
+	p.dwell[index] = saturatedUint16(c.dwell)
+	p.infectiousness[index] = float32(c.infectiousness)
+	p.selfIsolated[index] = c.selfIsolated
+	p.isolatedSince[index] = p.today - saturatedUint16(c.daysIsolated)
+	p.hospitality[index] = saturatedUint8(c.hospitality)
+	p.sicknessSeverity[index] = saturatedUint8(c.sicknessSeverity)
+	p.age[index] = saturatedUint8(c.age)
+	p.riskFactors[index] = c.riskFactors
+	p.vaccinated[index] = c.vaccinated
+	if p.birthday != nil {
+		p.birthday[index] = uint16(c.birthday)
+	}
+	for b := range p.adherence {
+		if p.adherence[b] != nil {
+			p.adherence[b][index] = c.adherence[b]
+		}
+	}
+	if p.treatments != nil {
+		p.treatments[index] = c.treatments
+		p.onset[index] = p.today - saturatedUint16(c.daysSinceOnset)
+	}
+	if p.healthcareWorker != nil {
+		p.healthcareWorker[index] = c.healthcareWorker
+	}
+}
+
+func (p *populationType) birthdayOf(index personIndex) int {
+	if p.birthday == nil {
+		return 0
+	}
+	return int(p.birthday[index])
+}
+
+func (p *populationType) adherenceOf(index personIndex) (adherence [behaviours]uint8) {
+	for b := range p.adherence {
+		if p.adherence[b] != nil {
+			adherence[b] = p.adherence[b][index]
+		}
+	}
+	return
+}
+
+func (p *populationType) treatmentsOf(index personIndex) uint8 {
+	if p.treatments == nil {
+		return 0
+	}
+	return p.treatments[index]
+}
+
+// daysSinceOnset counts the days since the citizen's symptoms showed up, that day included, with treatments only
+func (p *populationType) daysSinceOnset(index personIndex) int {
+	if p.onset == nil {
+		return 0
+	}
+	return int(p.today - p.onset[index])
+}
+
+// infect makes a citizen catch the disease today
+func (p *populationType) infect(index personIndex, state State, severity, dwell int, infectiousness float64) {
+	p.state[index] = state
+	p.sicknessSeverity[index] = uint8(severity)
+	p.entered[index] = p.today - 1
+	p.infected[index] = p.today
+	p.dwell[index] = saturatedUint16(dwell)
+	p.infectiousness[index] = float32(infectiousness)
+	if p.treatments != nil {
+		p.treatments[index] = 0
+		if state == StateIll {
+			p.onset[index] = p.today - 1
+		}
+	}
+}
+
+func saturatedUint8(v int) uint8 {
+	return uint8(math.Max(0, math.Min(float64(v), math.MaxUint8)))
+}
+
+func saturatedUint16(v int) uint16 {
+	return uint16(math.Max(0, math.Min(float64(v), math.MaxUint16)))
+}
+
+func (p *populationType) growAYear() {
+	for index := range p.state {
+		if p.state[index] != StateDead && p.state[index] != StateVacant && p.age[index] < math.MaxUint8 {
+			p.age[index]++
+		}
+	}
+}
+
+// tickNextDay moves every living citizen a day further in their state, without visiting any of them
+func (p *populationType) tickNextDay() {
+	p.today++
+}
+
+// daysInState counts the days since the citizen entered their state, that day included.
+// The dead stop counting on the day they died.
+func (p *populationType) daysInState(index personIndex) int {
+	if p.state[index] == StateDead {
+		return 1
+	}
+	return int(p.today - p.entered[index])
+}
+
+// daysIsolated counts the days since the citizen's isolation began, that day included, 0 if not isolated
+func (p *populationType) daysIsolated(index personIndex) int {
+	if !p.selfIsolated[index] {
+		return 0
+	}
+	return int(p.today - p.isolatedSince[index])
+}
+
+func (p *populationType) initialize(s *simulation) {
+	for index := range p.state {
+		person := citizen{
+			state:       StateHealthy,
+			personID:    p.id(personIndex(index)),
+			hospitality: s.r1.Intn(100) + s.parameters.BaseHospitality,
+			age:         s.getAge(s.r1.Intn(100)),
+		}
+		person.riskFactors = s.drawRiskFactors(person.age)
+		person.vaccinated = s.drawVaccinated(person.age)
+		if p.birthday != nil {
+			person.birthday = s.r1.Intn(365)
+		}
+		person.adherence = s.drawAdherence()
+		person.healthcareWorker = s.drawHealthcareWorker(person.age)
+		p.setCitizen(person)
+	}
+}
+
+func (p *populationType) logPopulation() {
+	filePopulationDescr, err := os.Create("population.csv")
+	checkError("Cannot create file", err)
+	defer filePopulationDescr.Close()
+
+	populationLog := csv.NewWriter(filePopulationDescr)
+	defer populationLog.Flush()
+	line := []string{"ID", "Age", "Days", "Dwell", "Infectiousness", "Hospitality", "Self-Isolated", "Sickness severity", "Risk factors", "Vaccinated", "State"}
+	populationLog.Write(line)
+
+	for index := range p.state {
+		person := p.citizen(personIndex(index))
+		line := []string{
+			fmt.Sprintf("[%v, %v]", person.personID[0], person.personID[1]),
+			fmt.Sprintf("%v", person.age),
+			fmt.Sprintf("%v", person.daysInState),
+			fmt.Sprintf("%v", person.dwell),
+			fmt.Sprintf("%.3f", person.infectiousness),
+			fmt.Sprintf("%v", person.hospitality),
+			fmt.Sprintf("%v", person.selfIsolated),
+			fmt.Sprintf("%v", person.sicknessSeverity),
+			fmt.Sprintf("%08b", person.riskFactors),
+			fmt.Sprintf("%v", person.vaccinated),
+			fmt.Sprintf("%v", person.state),
+		}
+		populationLog.Write(line)
+	}
+
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Risk factors (diabetes, obesity, immunosuppression...) are given to citizens at initialization,
+// with a prevalence depending on age. Each factor multiplies the daily chance of severe disease
+// (the transitions to hospital and ICU) and of death of the citizens who have it.
+
+const maximumRiskFactors = 8 // citizens keep their risk factors as a bit set in a byte
+
+type riskFactorSpecification struct {
+	Name       string
+	Prevalence map[int]float64 // % of the citizens having the factor by age group, keyed by the group's upper age bound
+	Severe     float64         // multiplies the chance to be hospitalized or taken to ICU, 1 when omitted
+	Death      float64         // multiplies the chance to die, 1 when omitted
+}
+
+type riskFactor struct {
+	name        string
+	ageBounds   []int
+	prevalences []float64
+	severe      float64
+	death       float64
+}
+
+func compileRiskFactors(parameters *mainParametersStruct) ([]riskFactor, error) {
+	if len(parameters.RiskFactors) > maximumRiskFactors {
+		return nil, fmt.Errorf("%v risk factors, at most %v supported", len(parameters.RiskFactors), maximumRiskFactors)
+	}
+
+	var factors []riskFactor
+	for _, specification := range parameters.RiskFactors {
+		factor := riskFactor{name: specification.Name, severe: specification.Severe, death: specification.Death}
+		if factor.name == "" {
+			return nil, fmt.Errorf("risk factor %v has no name", len(factors)+1)
+		}
+		if factor.severe == 0 {
+			factor.severe = 1
+		}
+		if factor.death == 0 {
+			factor.death = 1
+		}
+		for bound := range specification.Prevalence {
+			factor.ageBounds = append(factor.ageBounds, bound)
+		}
+		sort.Ints(factor.ageBounds)
+		for _, bound := range factor.ageBounds {
+			factor.prevalences = append(factor.prevalences, specification.Prevalence[bound])
+		}
+		factors = append(factors, factor)
+	}
+	return factors, nil
+}
+
+// prevalence of the factor at the given age, in %; the last group covers the older citizens
+func (factor *riskFactor) prevalence(age int) float64 {
+	for i, bound := range factor.ageBounds {
+		if age <= bound {
+			return factor.prevalences[i]
+		}
+	}
+	if len(factor.prevalences) == 0 {
+		return 0
+	}
+	return factor.prevalences[len(factor.prevalences)-1]
+}
+
+// multiplier of the chance of a transition to the given state for a citizen having the factor
+func (factor *riskFactor) multiplier(to State) float64 {
+	switch to {
+	case StateUnderTreatment, StateICU:
+		return factor.severe
+	case StateDead:
+		return factor.death
+	}
+	return 1
+}
+
+// drawRiskFactors decides which risk factors a citizen of the given age has
+func (s *simulation) drawRiskFactors(age int) (factors uint8) {
+	for i := range s.riskFactors {
+		if s.r1.Float64()*100 < s.riskFactors[i].prevalence(age) {
+			factors |= 1 << i
+		}
+	}
+	return
+}
+
+// riskGroupOutcomes are the cases and deaths among the citizens of a risk group
+type riskGroupOutcomes struct {
+	name      string
+	citizens  int
+	cases     int
+	dead      int
+	recovered int
+}
+
+// riskGroupOutcomes breaks the outcomes down by risk factor, the citizens without any making up the last group
+func (s *simulation) riskGroupOutcomes() []riskGroupOutcomes {
+	groups := make([]riskGroupOutcomes, len(s.riskFactors)+1)
+	for i := range s.riskFactors {
+		groups[i].name = s.riskFactors[i].name
+	}
+	groups[len(s.riskFactors)].name = "none"
+
+	for index, state := range s.population.state {
+		if state == StateVacant {
+			continue
+		}
+		factors := s.population.riskFactors[index]
+		for i := range groups {
+			if (i < len(s.riskFactors) && factors&(1<<i) != 0) || (i == len(s.riskFactors) && factors == 0) {
+				groups[i].citizens++
+				if state != StateHealthy {
+					groups[i].cases++
+				}
+				switch state {
+				case StateDead:
+					groups[i].dead++
+				case StateRecovered:
+					groups[i].recovered++
+				}
+			}
+		}
+	}
+	return groups
+}
+
+func (g riskGroupOutcomes) String() string {
+	fatality := 0.0
+	if g.cases > 0 {
+		fatality = float64(g.dead) * 100 / float64(g.cases)
+	}
+	return fmt.Sprintf("%-20v %10v %10v %10v %10v %14.2f", g.name, g.citizens, g.cases, g.dead, g.recovered, fatality)
+}
+
+func (s *simulation) logRiskGroups() {
+	if len(s.riskFactors) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("%-20v %10v %10v %10v %10v %14v", "Risk group", "Citizens", "Cases", "Dead", "Recovered", "Fatality, %")}
+	for _, group := range s.riskGroupOutcomes() {
+		lines = append(lines, group.String())
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+const diabetes = `{"RiskFactors": [{"Name": "Diabetes", "Prevalence": {"40": 10, "60": 30}, "Severe": 2, "Death": 3}]}`
+
+func TestRiskFactors(t *testing.T) {
+	p := testParameters(t, "config.json", diabetes)
+	p.Seed = 1
+	p.Transitions = []transitionRuleSpecification{
+		{From: StateIll, To: StateUnderTreatment, Probability: probabilitySpecification{Rate: quantity{Value: 10}}},
+		{From: StateIll, To: StateDead, Probability: probabilitySpecification{Rate: quantity{Value: 4}}},
+		{From: StateIll, To: StateRecovered, Probability: probabilitySpecification{Rate: quantity{Value: 20}}},
+		{From: StateUnderTreatment, To: StateRecovered, Probability: probabilitySpecification{Rate: quantity{Value: 20}}},
+	}
+	s := newSimulation(p)
+
+	factor := &s.riskFactors[0]
+	for age, expected := range map[int]float64{20: 10, 40: 10, 50: 30, 90: 30} {
+		if prevalence := factor.prevalence(age); prevalence != expected {
+			t.Errorf("prevalence at %v: %v%%, %v%% expected", age, prevalence, expected)
+		}
+	}
+
+	// severe disease and death are more likely with the factor, recovery is not
+	c := citizen{state: StateIll, age: 30}
+	at := c
+	at.riskFactors = 1
+	for i, multiplier := range []float64{2, 3, 1} {
+		rule := &s.transitionTable[StateIll][i]
+		if without, with := rule.weight(s, c), rule.weight(s, at); with != without*multiplier {
+			t.Errorf("%v: %v with the factor, %v without", rule.to, with, without)
+		}
+	}
+
+	const n = 100000
+	drawn := 0
+	for i := 0; i < n; i++ {
+		drawn += int(s.drawRiskFactors(50))
+	}
+	if share := float64(drawn) * 100 / n; math.Abs(share-30) > 1 {
+		t.Errorf("%.1f%% of the citizens of 50 drawn with the factor, 30%% expected", share)
+	}
+}
+
+func TestRiskGroupFatality(t *testing.T) {
+	p := testParameters(t, "config.json", diabetes)
+	p.Seed = 1
+	s, err := runChecked(p, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := s.riskGroupOutcomes()
+	fatality := func(g riskGroupOutcomes) float64 { return float64(g.dead) / float64(g.cases) }
+	if groups[0].cases == 0 || fatality(groups[0]) <= fatality(groups[1]) {
+		t.Errorf("fatality of %v with the factor, %v without", fatality(groups[0]), fatality(groups[1]))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transmission may follow the seasons: the chance to pass the disease on to a contact is
+// multiplied every day by a seasonal factor depending on the calendar date, given by one of
+//   - a sinusoid, 1 + Amplitude*cos(2π(day of the year - PeakDay)/365.25)
+//   - a multiplier for each of the 12 months, January first
+//   - a CSV file of multipliers by day of the year, every day taking the value of the last
+//     listed day before it (the last one of the year for the days before the first)
+//
+//	Day,Multiplier
+//	1,1.3
+//	91,1
+//	152,0.7
+//	244,1
+
+type seasonalitySpecification struct {
+	Amplitude float64   // relative swing of the sinusoid around its mean, 0.3 for ±30%
+	PeakDay   int       // day of the year the sinusoid peaks on, 1 for January 1st
+	Monthly   []float64 // multiplier of every month, January first
+	Daily     string    // CSV file of multipliers by day of the year
+}
+
+type seasonalityModel struct {
+	amplitude float64
+	peakDay   int
+	monthly   []float64
+	daily     []float64 // by day of the year, January 1st first; 366 days
+}
+
+func readDailyMultipliers(fn string) ([]float64, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%v: no multiplier", fn)
+	}
+
+	listed := make([]bool, 367)
+	values := make([]float64, 367)
+	for i, record := range records[1:] {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%v: row %v should be day,multiplier", fn, i+1)
+		}
+		day, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil || day < 1 || day > 366 {
+			return nil, fmt.Errorf("%v: invalid day of the year in row %v", fn, i+1)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%v: invalid multiplier in row %v", fn, i+1)
+		}
+		listed[day], values[day] = true, value
+	}
+
+	// the days before the first listed one carry the last value of the year over
+	last := 0.0
+	for day := 366; day >= 1; day-- {
+		if listed[day] {
+			last = values[day]
+			break
+		}
+	}
+	daily := make([]float64, 366)
+	for day := 1; day <= 366; day++ {
+		if listed[day] {
+			last = values[day]
+		}
+		daily[day-1] = last
+	}
+	return daily, nil
+}
+
+func compileSeasonality(specification *seasonalitySpecification) (*seasonalityModel, error) {
+	if specification == nil {
+		return nil, nil
+	}
+
+	forms := 0
+	if specification.Amplitude != 0 || specification.PeakDay != 0 {
+		forms++
+	}
+	if len(specification.Monthly) > 0 {
+		forms++
+	}
+	if specification.Daily != "" {
+		forms++
+	}
+	if forms != 1 {
+		return nil, fmt.Errorf("seasonality needs exactly one of a sinusoid, Monthly and Daily")
+	}
+
+	model := &seasonalityModel{amplitude: specification.Amplitude, peakDay: specification.PeakDay}
+	switch {
+	case specification.Daily != "":
+		daily, err := readDailyMultipliers(specification.Daily)
+		if err != nil {
+			return nil, fmt.Errorf("seasonality: %v", err)
+		}
+		model.daily = daily
+	case len(specification.Monthly) > 0:
+		if len(specification.Monthly) != 12 {
+			return nil, fmt.Errorf("seasonality: %v monthly multipliers, 12 expected", len(specification.Monthly))
+		}
+		for month, value := range specification.Monthly {
+			if value < 0 {
+				return nil, fmt.Errorf("seasonality: negative multiplier for month %v", month+1)
+			}
+		}
+		model.monthly = specification.Monthly
+	default:
+		if model.amplitude < 0 || model.amplitude > 1 {
+			return nil, fmt.Errorf("seasonality: amplitude out of 0-1")
+		}
+		if model.peakDay < 1 || model.peakDay > 366 {
+			return nil, fmt.Errorf("seasonality: peak day out of 1-366")
+		}
+	}
+	return model, nil
+}
+
+// multiplier is the seasonal factor of transmission on the given date
+func (m *seasonalityModel) multiplier(date time.Time) float64 {
+	switch {
+	case m == nil:
+		return 1
+	case m.daily != nil:
+		return m.daily[date.YearDay()-1]
+	case m.monthly != nil:
+		return m.monthly[date.Month()-1]
+	}
+	return 1 + m.amplitude*math.Cos(2*math.Pi*float64(date.YearDay()-m.peakDay)/365.25)
+}
+
+// transmissionMultiplier scales the chance to pass the disease on during the given day
+func (s *simulation) transmissionMultiplier(day int) float64 {
+	return s.seasonality.multiplier(s.calendar.date(day))
+}
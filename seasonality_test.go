@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestReadDailyMultipliers(t *testing.T) {
+	daily, err := readDailyMultipliers(writeFile(t, "daily.csv", "Day,Multiplier\n10,2\n100,0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 366 {
+		t.Fatalf("%v days, 366 expected", len(daily))
+	}
+	// the days before the first listed one carry the last value of the year over
+	for day, expected := range map[int]float64{1: 0.5, 9: 0.5, 10: 2, 99: 2, 100: 0.5, 366: 0.5} {
+		if daily[day-1] != expected {
+			t.Errorf("day %v: multiplier %v, %v expected", day, daily[day-1], expected)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"empty":          "",
+		"header only":    "Day,Multiplier\n",
+		"one column":     "Day\n10\n",
+		"day 0":          "Day,Multiplier\n0,1\n",
+		"day 367":        "Day,Multiplier\n367,1\n",
+		"not a number":   "Day,Multiplier\n10,high\n",
+		"negative value": "Day,Multiplier\n10,-1\n",
+	} {
+		if _, err := readDailyMultipliers(writeFile(t, "daily.csv", content)); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sensitivitySpecification describes a global sensitivity analysis.
+// Every parameter is varied within its From..To bounds.
+type sensitivitySpecification struct {
+	Method     string // "sobol" (Saltelli design) or "morris" (elementary effects)
+	Samples    int    // base sample size for Sobol, number of trajectories for Morris
+	Levels     int    // Morris grid levels
+	Workers    int
+	Output     string
+	Parameters map[string]sweepRange
+}
+
+var sensitivityOutcomes = []string{"Final deaths", "Peak ill", "Epidemic duration"}
+
+func (summary simulationSummary) outcomes() []float64 {
+	return []float64{float64(summary.dead), float64(summary.peakIll), float64(summary.days)}
+}
+
+// latinHypercube returns n points in the unit k-cube, each dimension split into n equally likely strata
+func latinHypercube(r *rand.Rand, n, k int) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, k)
+	}
+	for d := 0; d < k; d++ {
+		for i, stratum := range r.Perm(n) {
+			points[i][d] = (float64(stratum) + r.Float64()) / float64(n)
+		}
+	}
+	return points
+}
+
+// scaleToBounds maps a point of the unit cube onto the parameter ranges
+func scaleToBounds(point []float64, bounds []sweepRange) []float64 {
+	values := make([]float64, len(point))
+	for i, u := range point {
+		values[i] = bounds[i].From + u*(bounds[i].To-bounds[i].From)
+	}
+	return values
+}
+
+func meanAndVariance(values []float64) (mean, variance float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values))
+	return
+}
+
+// sobolIndices estimates first and total order indices from a Saltelli design:
+// runs are laid out as N rows of [A, B, AB_1 .. AB_k] (Saltelli 2010 first order, Jansen total order)
+func sobolIndices(y []float64, n, k int) (first, total []float64) {
+	row := k + 2
+	fA := make([]float64, n)
+	fB := make([]float64, n)
+	for j := 0; j < n; j++ {
+		fA[j] = y[j*row]
+		fB[j] = y[j*row+1]
+	}
+	_, variance := meanAndVariance(append(append([]float64{}, fA...), fB...))
+
+	first = make([]float64, k)
+	total = make([]float64, k)
+	if variance == 0 {
+		return
+	}
+	for i := 0; i < k; i++ {
+		var s, st float64
+		for j := 0; j < n; j++ {
+			fABi := y[j*row+2+i]
+			s += fB[j] * (fABi - fA[j])
+			st += (fA[j] - fABi) * (fA[j] - fABi)
+		}
+		first[i] = s / float64(n) / variance
+		total[i] = st / float64(2*n) / variance
+	}
+	return
+}
+
+// runSobol builds the Saltelli design: every row of the design shares a seed (common random numbers)
+func runSobol(specification sensitivitySpecification, parameters mainParametersStruct, names []string, bounds []sweepRange, r *rand.Rand, baseSeed int64) [][]string {
+	n, k := specification.Samples, len(names)
+	a := latinHypercube(r, n, k)
+	b := latinHypercube(r, n, k)
+
+	var jobs []sweepJob
+	for j := 0; j < n; j++ {
+		points := [][]float64{a[j], b[j]}
+		for i := 0; i < k; i++ {
+			abi := append([]float64{}, a[j]...)
+			abi[i] = b[j][i]
+			points = append(points, abi)
+		}
+		for _, point := range points {
+			jobs = append(jobs, sweepJob{index: len(jobs), values: scaleToBounds(point, bounds), seed: baseSeed + int64(j)})
+		}
+	}
+
+	fmt.Printf("Sobol analysis of %v parameters: %v runs\n", k, len(jobs))
+	results := runJobs(parameters, names, jobs, specification.Workers)
+
+	var table [][]string
+	table = append(table, []string{"Parameter", "Outcome", "First order", "Total order"})
+	for o, outcome := range sensitivityOutcomes {
+		y := make([]float64, len(results))
+		for i, result := range results {
+			y[i] = result.summary.outcomes()[o]
+		}
+		first, total := sobolIndices(y, n, k)
+		for i, name := range names {
+			table = append(table, []string{name, outcome, fmt.Sprintf("%.4f", first[i]), fmt.Sprintf("%.4f", total[i])})
+		}
+	}
+	return table
+}
+
+// runMorris walks one-at-a-time trajectories over a p-level grid and reports
+// the mean, mean absolute value and standard deviation of the elementary effects
+func runMorris(specification sensitivitySpecification, parameters mainParametersStruct, names []string, bounds []sweepRange, r *rand.Rand, baseSeed int64) [][]string {
+	trajectories, k, levels := specification.Samples, len(names), specification.Levels
+	if levels < 2 {
+		levels = 4
+	}
+	delta := float64(levels) / float64(2*(levels-1))
+
+	type step struct{ trajectory, factor int }
+	var jobs []sweepJob
+	var steps [][]step // steps[t][m] tells which factor changed between point m and m+1 of trajectory t
+
+	for t := 0; t < trajectories; t++ {
+		point := make([]float64, k)
+		for i := range point {
+			// base values are restricted to the lower half of the grid, so that +delta stays inside [0, 1]
+			point[i] = float64(r.Intn(levels/2)) / float64(levels-1)
+		}
+		jobs = append(jobs, sweepJob{index: len(jobs), values: scaleToBounds(point, bounds), seed: baseSeed + int64(t)})
+
+		var trajectorySteps []step
+		for _, factor := range r.Perm(k) {
+			point = append([]float64{}, point...)
+			point[factor] += delta
+			jobs = append(jobs, sweepJob{index: len(jobs), values: scaleToBounds(point, bounds), seed: baseSeed + int64(t)})
+			trajectorySteps = append(trajectorySteps, step{t, factor})
+		}
+		steps = append(steps, trajectorySteps)
+	}
+
+	fmt.Printf("Morris analysis of %v parameters: %v runs\n", k, len(jobs))
+	results := runJobs(parameters, names, jobs, specification.Workers)
+
+	var table [][]string
+	table = append(table, []string{"Parameter", "Outcome", "Mu", "Mu star", "Sigma"})
+	for o, outcome := range sensitivityOutcomes {
+		effects := make([][]float64, k)
+		for t, trajectorySteps := range steps {
+			first := t * (k + 1)
+			for m, s := range trajectorySteps {
+				before := results[first+m].summary.outcomes()[o]
+				after := results[first+m+1].summary.outcomes()[o]
+				effects[s.factor] = append(effects[s.factor], (after-before)/delta)
+			}
+		}
+		for i, name := range names {
+			mu, variance := meanAndVariance(effects[i])
+			absolute := make([]float64, len(effects[i]))
+			for j, e := range effects[i] {
+				absolute[j] = math.Abs(e)
+			}
+			muStar, _ := meanAndVariance(absolute)
+			table = append(table, []string{name, outcome, fmt.Sprintf("%.4f", mu), fmt.Sprintf("%.4f", muStar), fmt.Sprintf("%.4f", math.Sqrt(variance))})
+		}
+	}
+	return table
+}
+
+func runSensitivity(fn string, parameters mainParametersStruct) {
+	var specification sensitivitySpecification
+	readJSON(fn, &specification)
+
+	if len(specification.Parameters) == 0 {
+		fmt.Println("No parameters to analyse")
+		return
+	}
+	if specification.Samples <= 0 {
+		specification.Samples = 32
+	}
+	if specification.Output == "" {
+		specification.Output = "sensitivity.csv"
+	}
+
+	var names []string
+	for name := range specification.Parameters {
+		checkError("Invalid sensitivity analysis: ", setParameter(&mainParametersStruct{}, name, 0))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var bounds []sweepRange
+	for _, name := range names {
+		bounds = append(bounds, specification.Parameters[name])
+	}
+
+	baseSeed := parameters.Seed
+	if baseSeed == 0 {
+		baseSeed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(baseSeed))
+
+	var table [][]string
+	switch strings.ToLower(specification.Method) {
+	case "morris":
+		table = runMorris(specification, parameters, names, bounds, r, baseSeed)
+	case "sobol", "":
+		table = runSobol(specification, parameters, names, bounds, r, baseSeed)
+	default:
+		checkError("Invalid sensitivity analysis: ", fmt.Errorf("unknown method %q", specification.Method))
+	}
+
+	file, err := os.Create(specification.Output)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	sensitivityLog := csv.NewWriter(file)
+	defer sensitivityLog.Flush()
+
+	for _, line := range table {
+		sensitivityLog.Write(line)
+		fmt.Println(strings.Join(line, "\t"))
+	}
+
+	fmt.Printf("Sensitivity indices written to %v\n", specification.Output)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSobolIndices(t *testing.T) {
+	// y = x1 + 2 x2, x3 left out: x1 explains a fifth of the variance, x2 the rest
+	model := func(x []float64) float64 { return x[0] + 2*x[1] }
+	expected := []float64{0.2, 0.8, 0}
+
+	r := rand.New(rand.NewSource(1))
+	const n, k = 50000, 3
+	var y []float64
+	for j := 0; j < n; j++ {
+		a, b := make([]float64, k), make([]float64, k)
+		for i := range a {
+			a[i], b[i] = r.Float64(), r.Float64()
+		}
+		y = append(y, model(a), model(b))
+		for i := 0; i < k; i++ {
+			abi := append([]float64{}, a...)
+			abi[i] = b[i]
+			y = append(y, model(abi))
+		}
+	}
+
+	first, total := sobolIndices(y, n, k)
+	for i := range expected {
+		if math.Abs(first[i]-expected[i]) > 0.03 {
+			t.Errorf("x%v: first order index %v, %v expected", i+1, first[i], expected[i])
+		}
+		// without interactions the total order indices are the first order ones
+		if math.Abs(total[i]-expected[i]) > 0.03 {
+			t.Errorf("x%v: total order index %v, %v expected", i+1, total[i], expected[i])
+		}
+	}
+
+	first, total = sobolIndices(make([]float64, n*(k+2)), n, k)
+	for i := range first {
+		if first[i] != 0 || total[i] != 0 {
+			t.Errorf("x%v: indices %v and %v of a constant outcome", i+1, first[i], total[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// The severity of a case is drawn when the citizen catches the disease, from the shares of
+// SeverityLevelsDistribution. The share of every level can be multiplied according to the
+// citizen (age group, risk factors, vaccination) and to the circulating variant, the levels
+// being drawn in proportion to the resulting weights.
+
+const (
+	severityLow      = iota // no or barely any symptoms
+	severityMild            // symptoms, recovery at home
+	severitySevere          // hospitalization
+	severityCritical        // ICU
+	severityLevels
+)
+
+var severityNames = [severityLevels]string{"Low", "Mild", "Severe", "Critical"}
+
+// severityMultipliers multiply the shares of the severity levels, keyed by level name
+type severityMultipliers map[string]float64
+
+type severitySpecification struct {
+	ByAge        map[int]severityMultipliers    // by age group, keyed by the group's upper age bound
+	ByRiskFactor map[string]severityMultipliers // for the citizens having the risk factor
+	Vaccinated   severityMultipliers            // for the vaccinated citizens
+	ByVariant    map[string]severityMultipliers // while the variant circulates, see Variant
+}
+
+type severityWeights [severityLevels]float64
+
+type severityModel struct {
+	shares      severityWeights
+	ageBounds   []int
+	byAge       []severityWeights
+	byRisk      []severityWeights // in the order of the risk factors
+	vaccinated  severityWeights
+	withVariant severityWeights
+}
+
+func (m severityMultipliers) weights() (result severityWeights, err error) {
+	for level := range result {
+		result[level] = 1
+	}
+	for name, multiplier := range m {
+		level, err := parseSeverity(name)
+		if err != nil {
+			return result, err
+		}
+		result[level] = multiplier
+	}
+	return result, nil
+}
+
+func parseSeverity(name string) (int, error) {
+	for level, levelName := range severityNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity level %q", name)
+}
+
+func compileSeverity(parameters *mainParametersStruct, riskFactors []riskFactor) (model severityModel, err error) {
+	total := 0.0
+	for name, share := range parameters.SeverityLevelsDistribution {
+		level, err := parseSeverity(name)
+		if err != nil {
+			return model, err
+		}
+		model.shares[level] = share
+		total += share
+	}
+	if total <= 0 {
+		return model, fmt.Errorf("no case in SeverityLevelsDistribution")
+	}
+
+	specification := parameters.Severity
+	for bound := range specification.ByAge {
+		model.ageBounds = append(model.ageBounds, bound)
+	}
+	sort.Ints(model.ageBounds)
+	for _, bound := range model.ageBounds {
+		weights, err := specification.ByAge[bound].weights()
+		if err != nil {
+			return model, fmt.Errorf("age group %v: %v", bound, err)
+		}
+		model.byAge = append(model.byAge, weights)
+	}
+
+	for name := range specification.ByRiskFactor {
+		found := false
+		for _, factor := range riskFactors {
+			found = found || factor.name == name
+		}
+		if !found {
+			return model, fmt.Errorf("unknown risk factor %q", name)
+		}
+	}
+	for _, factor := range riskFactors {
+		weights, err := specification.ByRiskFactor[factor.name].weights()
+		if err != nil {
+			return model, fmt.Errorf("risk factor %v: %v", factor.name, err)
+		}
+		model.byRisk = append(model.byRisk, weights)
+	}
+
+	if model.vaccinated, err = specification.Vaccinated.weights(); err != nil {
+		return model, fmt.Errorf("vaccinated: %v", err)
+	}
+	if model.withVariant, err = specification.ByVariant[parameters.Variant].weights(); err != nil {
+		return model, fmt.Errorf("variant %v: %v", parameters.Variant, err)
+	}
+	return model, nil
+}
+
+// drawSeverity picks the severity of the case of a citizen who has just caught the disease
+func (s *simulation) drawSeverity(c citizen, r1 *rand.Rand) int {
+	weights := s.severity.shares
+	multiply := func(multipliers severityWeights) {
+		for level := range weights {
+			weights[level] *= multipliers[level]
+		}
+	}
+
+	for i, bound := range s.severity.ageBounds {
+		if c.age <= bound {
+			multiply(s.severity.byAge[i])
+			break
+		}
+	}
+	for i := range s.severity.byRisk {
+		if c.riskFactors&(1<<i) != 0 {
+			multiply(s.severity.byRisk[i])
+		}
+	}
+	if c.vaccinated {
+		multiply(s.severity.vaccinated)
+	}
+	multiply(s.severity.withVariant)
+
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	pick := r1.Float64() * total
+	chosen := severityLow
+	for level, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		if chosen = level; pick < weight {
+			break
+		}
+		pick -= weight
+	}
+	return chosen
+}
+
+// drawVaccinated decides whether a citizen of the given age was vaccinated before the epidemic
+func (s *simulation) drawVaccinated(age int) bool {
+	if len(s.parameters.VaccinationCoverage) == 0 {
+		return false
+	}
+	group, coverage := -1, 0.0
+	for bound, value := range s.parameters.VaccinationCoverage {
+		if age <= bound && (group < 0 || bound < group) {
+			group, coverage = bound, value
+		}
+	}
+	return s.r1.Float64()*100 < coverage
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// severityShares draws the severity of many cases of the citizen, in % by level
+func severityShares(s *simulation, c citizen) (shares [severityLevels]float64) {
+	const n = 100000
+	for i := 0; i < n; i++ {
+		shares[s.drawSeverity(c, s.r1)] += 100.0 / n
+	}
+	return
+}
+
+func TestDrawSeverity(t *testing.T) {
+	p := testParameters(t, "config.json", `{
+		"SeverityLevelsDistribution": {"Low": 30, "Mild": 56, "Severe": 10, "Critical": 4},
+		"Severity": {
+			"ByAge": {"60": {}, "120": {"Severe": 3, "Critical": 6}},
+			"Vaccinated": {"Severe": 0.5, "Critical": 0},
+			"ByVariant": {"delta": {"Low": 0.5}}
+		}
+	}`)
+	p.Seed = 1
+	s := newSimulation(p)
+
+	for _, test := range []struct {
+		name     string
+		c        citizen
+		expected [severityLevels]float64
+	}{
+		{"young", citizen{age: 30}, [severityLevels]float64{30, 56, 10, 4}},
+		// 30, 56, 30 and 24 out of 140
+		{"old", citizen{age: 70}, [severityLevels]float64{21.43, 40, 21.43, 17.14}},
+		// 30, 56, 15 and 0 out of 101
+		{"old and vaccinated", citizen{age: 70, vaccinated: true}, [severityLevels]float64{29.70, 55.45, 14.85, 0}},
+	} {
+		shares := severityShares(s, test.c)
+		for level, expected := range test.expected {
+			if math.Abs(shares[level]-expected) > 0.5 {
+				t.Errorf("%v: %.2f%% of %v cases, %v%% expected", test.name, shares[level], severityNames[level], expected)
+			}
+		}
+	}
+
+	// the variant only weighs while it circulates
+	p.Variant = "delta"
+	s = newSimulation(p)
+	// 15, 56, 10 and 4 out of 85
+	if shares := severityShares(s, citizen{age: 30}); math.Abs(shares[severityLow]-17.65) > 0.5 {
+		t.Errorf("%.2f%% of low cases with the variant, 17.65%% expected", shares[severityLow])
+	}
+
+	for name, overrides := range map[string]string{
+		"unknown level":       `{"Severity": {"Vaccinated": {"Moderate": 2}}}`,
+		"unknown risk factor": `{"Severity": {"ByRiskFactor": {"Asthma": {"Severe": 2}}}}`,
+	} {
+		p := testParameters(t, "config.json", overrides)
+		if _, err := compileSeverity(&p, nil); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+// The example course of hospital.json admits the severe and critical cases alone, and takes
+// the critical ones alone to ICU
+func TestHospitalCourse(t *testing.T) {
+	p := loadParameters("hospital.json")
+	p.Seed = 1
+	s := newSimulation(p)
+	admitted, inICU := 0, 0
+	for !s.finished() {
+		s.stepDay()
+		for index, state := range s.population.state {
+			severity := s.population.sicknessSeverity[index]
+			switch {
+			case state == StateUnderTreatment && severity < severitySevere:
+				t.Fatalf("day %v: a case of %v severity in hospital", s.globalStats.daysCount, severityNames[severity])
+			case state == StateICU && severity != severityCritical:
+				t.Fatalf("day %v: a case of %v severity in ICU", s.globalStats.daysCount, severityNames[severity])
+			}
+		}
+		admitted = max(admitted, s.globalStats.totalHospitalized)
+		inICU = max(inICU, s.globalStats.totalICU)
+	}
+	if admitted == 0 || inICU == 0 {
+		t.Errorf("at most %v citizens in hospital and %v in ICU", admitted, inICU)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// State is the condition of a citizen. It is small enough to be stored packed, one byte per citizen.
+type State uint8
+
+const (
+	StateHealthy        State = iota
+	StateSusceptible          // = exposed
+	StateInfected             // = asymptomatic
+	StateIll                  // = symptomatic
+	StateUnderTreatment       // = hospitalization
+	StateICU                  // = ventilation / ICU
+	StateRecovered            // = positive outcome
+	StateDead                 // = negative outcome
+	StateVacant               // = an empty cell, see demographics.go
+
+	stateCount = iota
+)
+
+var stateNames = [stateCount]string{
+	StateHealthy:        "healthy",
+	StateSusceptible:    "susceptible",
+	StateInfected:       "infected",
+	StateIll:            "ill",
+	StateUnderTreatment: "underTreatment",
+	StateICU:            "icu",
+	StateRecovered:      "recovered",
+	StateDead:           "dead",
+	StateVacant:         "vacant",
+}
+
+func (state State) String() string {
+	if int(state) < len(stateNames) {
+		return stateNames[state]
+	}
+	return fmt.Sprintf("State(%d)", uint8(state))
+}
+
+func parseState(name string) (State, error) {
+	for state, stateName := range stateNames {
+		if stateName == name {
+			return State(state), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q", name)
+}
+
+// UnmarshalJSON reads states by their names
+func (state *State) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, err := parseState(name)
+	if err != nil {
+		return err
+	}
+	*state = parsed
+	return nil
+}
+
+func (state State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(state.String())
+}
+
+// UnmarshalText lets states key JSON objects by their names
+func (state *State) UnmarshalText(text []byte) (err error) {
+	*state, err = parseState(string(text))
+	return
+}
+
+func (state State) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+// infectious tells whether a citizen in this state passes the disease on to their contacts
+func (state State) infectious() bool {
+	return state == StateSusceptible || state == StateInfected || state == StateIll
+}
+
+// settled states are out of the epidemic: the citizen recovered or died, or the cell is empty
+func (state State) settled() bool {
+	return state == StateRecovered || state == StateDead || state == StateVacant
+}
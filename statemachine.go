@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+// The progression of the disease is driven by a declarative transition table: for every state,
+// an ordered list of rules saying where a citizen may go, after how many days and with which
+// daily chance. Each day the rules of the citizen's state are tried in order, and the first one
+// that applies and wins its roll moves the citizen. Catching the disease from a contact
+// (healthy -> susceptible) is not part of the table, it happens in collectTransitions.
+
+// quantity is a number of the transition table, given either literally (5) or by naming
+// a numeric parameter ("GrayPeriod"). "CurrentMortality" stands for the mortality of the day.
+type quantity struct {
+	Value     float64
+	Parameter string
+}
+
+func (q *quantity) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &q.Parameter); err == nil {
+		return nil
+	}
+	q.Parameter = ""
+	return json.Unmarshal(data, &q.Value)
+}
+
+func (q quantity) MarshalJSON() ([]byte, error) {
+	if q.Parameter != "" {
+		return json.Marshal(q.Parameter)
+	}
+	return json.Marshal(q.Value)
+}
+
+// compile resolves the quantity against the run's parameters
+func (q quantity) compile(parameters *mainParametersStruct) (func(s *simulation) float64, error) {
+	switch q.Parameter {
+	case "":
+		value := q.Value
+		return func(*simulation) float64 { return value }, nil
+	case "CurrentMortality":
+		return func(s *simulation) float64 { return float64(s.globalStats.currentMortality) }, nil
+	}
+
+	field := reflect.ValueOf(parameters).Elem().FieldByName(q.Parameter)
+	var value float64
+	switch {
+	case !field.IsValid():
+		return nil, fmt.Errorf("unknown parameter %q", q.Parameter)
+	case field.CanInt():
+		value = float64(field.Int())
+	case field.CanFloat():
+		value = field.Float()
+	default:
+		return nil, fmt.Errorf("parameter %q is not numeric", q.Parameter)
+	}
+	return func(*simulation) float64 { return value }, nil
+}
+
+// probabilitySpecification is the daily chance (in %) of a transition, as a function of the citizen
+type probabilitySpecification struct {
+	Rate       quantity
+	Scale      float64         // multiplies Rate, 1 when omitted
+	ByAge      map[int]float64 // multiplier by age group, keyed by the group's upper age bound
+	BySeverity map[int]float64 // multiplier by sicknessSeverity
+}
+
+type transitionRuleSpecification struct {
+	From        State
+	To          State
+	MinDays     quantity // days to spend in From before the rule applies
+	BeforeDays  quantity // the rule no longer applies from this day on, 0 for never
+	Pathway     string   // "symptomatic" or "asymptomatic" to restrict the rule to one pathway, see AsymptomaticSeverities
+	Probability probabilitySpecification
+}
+
+// defaultTransitions is the course of the disease when the config doesn't describe one; it never
+// goes through hospital or ICU, hospital.json gives an example of a course that does
+func defaultTransitions(parameters *mainParametersStruct) []transitionRuleSpecification {
+	specifications := []transitionRuleSpecification{
+		// get a chance to die
+		{From: StateIll, To: StateDead,
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "CurrentMortality"}}},
+		// get a chance to recover
+		{From: StateIll, To: StateRecovered, MinDays: quantity{Parameter: "DaysBeforeSelfRecovery"},
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "SelfRecoveryRate"}, Scale: 0.5}},
+		// get a chance to get ill
+		{From: StateSusceptible, To: StateIll, MinDays: quantity{Parameter: "GrayPeriod"},
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "InfectionRate"}}},
+		// get a chance to recover without symptoms, until symptoms may show up
+		{From: StateSusceptible, To: StateRecovered, MinDays: quantity{Parameter: "DaysBeforeSelfRecovery"}, BeforeDays: quantity{Parameter: "GrayPeriod"},
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "SelfRecoveryRate"}}},
+	}
+	if len(parameters.AsymptomaticSeverities) == 0 {
+		return specifications
+	}
+
+	// the asymptomatic become infected instead of ill, and recover the way the ill do
+	specifications[2].Pathway = "symptomatic"
+	return append(specifications,
+		transitionRuleSpecification{From: StateSusceptible, To: StateInfected, MinDays: quantity{Parameter: "GrayPeriod"}, Pathway: "asymptomatic",
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "InfectionRate"}}},
+		transitionRuleSpecification{From: StateInfected, To: StateRecovered, MinDays: quantity{Parameter: "DaysBeforeSelfRecovery"},
+			Probability: probabilitySpecification{Rate: quantity{Parameter: "SelfRecoveryRate"}, Scale: 0.5}},
+	)
+}
+
+// asymptomatic tells whether a citizen of the given sickness severity never shows symptoms
+func (parameters *mainParametersStruct) asymptomatic(severity int) bool {
+	for _, asymptomatic := range parameters.AsymptomaticSeverities {
+		if severity == asymptomatic {
+			return true
+		}
+	}
+	return false
+}
+
+type transitionRule struct {
+	to         State
+	minDays    int
+	beforeDays int
+	rate       func(s *simulation) float64
+	scale      float64
+	pathway    func(c citizen) bool // nil when the rule applies to both pathways
+
+	ageBounds      []int
+	ageMultipliers []float64
+	bySeverity     map[int]float64
+}
+
+type transitionTable [stateCount][]transitionRule
+
+// leads tells whether a rule of the table takes citizens from one state to another
+func (table *transitionTable) leads(from, to State) bool {
+	for _, rule := range table[from] {
+		if rule.to == to {
+			return true
+		}
+	}
+	return false
+}
+
+func compileTransitions(parameters *mainParametersStruct) (table transitionTable, err error) {
+	specifications := parameters.Transitions
+	if len(specifications) == 0 {
+		specifications = defaultTransitions(parameters)
+	}
+
+	for _, specification := range specifications {
+		if specification.From >= stateCount || specification.To >= stateCount {
+			return table, fmt.Errorf("transition %v -> %v: unknown state", specification.From, specification.To)
+		}
+		// the healthy catch the disease from their contacts, the dead and the empty cells stay as they are
+		if specification.From == StateHealthy || specification.From == StateDead || specification.From == StateVacant {
+			return table, fmt.Errorf("transition %v -> %v: no rule leads out of the %v state", specification.From, specification.To, specification.From)
+		}
+
+		rule := transitionRule{
+			to:         specification.To,
+			scale:      specification.Probability.Scale,
+			bySeverity: specification.Probability.BySeverity,
+		}
+		if rule.scale == 0 {
+			rule.scale = 1
+		}
+
+		var minDays, beforeDays func(*simulation) float64
+		if minDays, err = specification.MinDays.compile(parameters); err == nil {
+			beforeDays, err = specification.BeforeDays.compile(parameters)
+		}
+		if err == nil {
+			rule.rate, err = specification.Probability.Rate.compile(parameters)
+		}
+		if err != nil {
+			return table, fmt.Errorf("transition %v -> %v: %v", specification.From, specification.To, err)
+		}
+		if specification.MinDays.Parameter == "CurrentMortality" || specification.BeforeDays.Parameter == "CurrentMortality" {
+			return table, fmt.Errorf("transition %v -> %v: days cannot depend on the current mortality", specification.From, specification.To)
+		}
+		rule.minDays, rule.beforeDays = int(minDays(nil)), int(beforeDays(nil))
+
+		switch specification.Pathway {
+		case "":
+		case "symptomatic", "asymptomatic":
+			wanted := specification.Pathway == "asymptomatic"
+			rule.pathway = func(c citizen) bool { return parameters.asymptomatic(c.sicknessSeverity) == wanted }
+		default:
+			return table, fmt.Errorf("transition %v -> %v: unknown pathway %q", specification.From, specification.To, specification.Pathway)
+		}
+
+		for bound := range specification.Probability.ByAge {
+			rule.ageBounds = append(rule.ageBounds, bound)
+		}
+		sort.Ints(rule.ageBounds)
+		for _, bound := range rule.ageBounds {
+			rule.ageMultipliers = append(rule.ageMultipliers, specification.Probability.ByAge[bound])
+		}
+
+		table[specification.From] = append(table[specification.From], rule)
+	}
+	return table, nil
+}
+
+// compileModel prepares everything the run's parameters describe: the transition table, the dwell times,
+// the contact matrices, the risk factors, the severity of the cases, the demographics, the calendar,
+// the importation, the protective behaviours, the adaptive behaviour, the isolation rules, the treatments and the healthcare workers
+func (s *simulation) compileModel() (err error) {
+	if s.transitionTable, err = compileTransitions(&s.parameters); err != nil {
+		return err
+	}
+	if s.dwellTimes, err = compileDwellTimes(&s.parameters); err != nil {
+		return err
+	}
+	if s.contacts, err = compileContactMatrices(s.parameters.ContactMatrix); err != nil {
+		return err
+	}
+	if s.riskFactors, err = compileRiskFactors(&s.parameters); err != nil {
+		return err
+	}
+	if s.severity, err = compileSeverity(&s.parameters, s.riskFactors); err != nil {
+		return err
+	}
+	if s.demographics, err = compileDemographics(s.parameters.Demographics); err != nil {
+		return err
+	}
+	if s.calendar, err = compileCalendar(&s.parameters); err != nil {
+		return err
+	}
+	if s.seasonality, err = compileSeasonality(s.parameters.Seasonality); err != nil {
+		return err
+	}
+	if s.importation, err = compileImportation(s.parameters.Importation, s.calendar); err != nil {
+		return err
+	}
+	if err = s.compileBehaviours(); err != nil {
+		return err
+	}
+	if s.adaptive, err = compileAdaptiveBehaviour(s.parameters.AdaptiveBehaviour); err != nil {
+		return err
+	}
+	if s.isolation, err = compileIsolation(s.parameters.Isolation); err != nil {
+		return err
+	}
+	if s.treatments, err = compileTreatments(&s.parameters); err != nil {
+		return err
+	}
+	s.healthcare, err = compileHealthcareWorkers(s.parameters.HealthcareWorkers)
+	return err
+}
+
+func (rule *transitionRule) applies(c citizen) bool {
+	return c.daysInState >= rule.minDays && (rule.beforeDays <= 0 || c.daysInState < rule.beforeDays) &&
+		(rule.pathway == nil || rule.pathway(c))
+}
+
+// weight is the daily chance of the transition for the citizen, in %
+func (rule *transitionRule) weight(s *simulation, c citizen) float64 {
+	chance := rule.rate(s) * rule.scale
+	for i, bound := range rule.ageBounds {
+		if c.age <= bound {
+			chance *= rule.ageMultipliers[i]
+			break
+		}
+	}
+	if multiplier, ok := rule.bySeverity[c.sicknessSeverity]; ok {
+		chance *= multiplier
+	}
+	for i := range s.riskFactors {
+		if c.riskFactors&(1<<i) != 0 {
+			chance *= s.riskFactors[i].multiplier(rule.to)
+		}
+	}
+	for i := range s.treatments {
+		if c.treatments&(1<<i) != 0 {
+			chance *= s.treatments[i].multiplier(c.state, rule.to)
+		}
+	}
+	return chance
+}
+
+// followed tells whether the engines play the citizens of a state every day: the sick, and the
+// recovered when the transition table moves them on (as their immunity wanes, for instance)
+func (s *simulation) followed(state State) bool {
+	return state != StateHealthy && (!state.settled() || len(s.transitionTable[state]) > 0)
+}
+
+// nextTransition is the rule the citizen follows today, nil if they stay. Without a dwell time
+// the rules are tried in order, each with its daily chance. With one, the citizen waits until
+// the sampled number of days has passed, then the weights of the applicable rules decide.
+func (s *simulation) nextTransition(c citizen, r1 *rand.Rand) *transitionRule {
+	rules := s.transitionTable[c.state]
+	if s.dwellTimes[c.state] == nil {
+		for i := range rules {
+			if rules[i].applies(c) && r1.Float64()*100 < rules[i].weight(s, c) {
+				return &rules[i]
+			}
+		}
+		return nil
+	}
+
+	if c.daysInState <= c.dwell {
+		return nil
+	}
+	total := 0.0
+	for i := range rules {
+		if rules[i].applies(c) {
+			total += math.Max(rules[i].weight(s, c), 0)
+		}
+	}
+	if total <= 0 {
+		return nil
+	}
+	pick := r1.Float64() * total
+	var chosen *transitionRule
+	for i := range rules {
+		if weight := math.Max(rules[i].weight(s, c), 0); rules[i].applies(c) && weight > 0 {
+			chosen = &rules[i]
+			if pick -= weight; pick < 0 {
+				break
+			}
+		}
+	}
+	return chosen
+}
+
+// counter is the globalStats field counting the citizens in a state
+func (globalStats *globalStatsStruct) counter(state State) *int {
+	switch state {
+	case StateHealthy:
+		return &globalStats.totalIntact
+	case StateSusceptible:
+		return &globalStats.totalInfected
+	case StateInfected:
+		return &globalStats.totalAsymptomatic
+	case StateIll:
+		return &globalStats.totalIll
+	case StateUnderTreatment:
+		return &globalStats.totalHospitalized
+	case StateICU:
+		return &globalStats.totalICU
+	case StateRecovered:
+		return &globalStats.totalRecovered
+	case StateDead:
+		return &globalStats.totalDead
+	default:
+		return &globalStats.totalVacant
+	}
+}
+
+// enterState moves a citizen on, keeping the counters and running the state's entry actions
+func (s *simulation) enterState(c *citizen, to State, r1 *rand.Rand, delta *globalStatsStruct) {
+	*delta.counter(c.state)--
+	*delta.counter(to)++
+	c.state = to
+	c.daysInState = 1
+	c.dwell = s.dwell(to, r1)
+	if to == StateICU && c.treatments != 0 && c.dwell > 0 {
+		c.dwell = s.icuStay(*c, c.dwell)
+	}
+
+	if to == StateIll {
+		delta.totalEverIll++
+		c.daysSinceOnset = 1
+
+		// self-isolate
+		if r1.Intn(100) < s.parameters.SelfIsolationRate {
+			c.selfIsolated = true
+			c.daysIsolated = 1
+			delta.totalSelfIsolated++
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sweepRange lists the values a single parameter takes during a sweep:
+// either explicitly (Values) or as an inclusive From..To range with a Step
+type sweepRange struct {
+	Values []float64
+	From   float64
+	To     float64
+	Step   float64
+}
+
+func (r sweepRange) values() []float64 {
+	if len(r.Values) > 0 {
+		return r.Values
+	}
+	if r.Step <= 0 {
+		return []float64{r.From}
+	}
+
+	var result []float64
+	for v := r.From; v <= r.To+r.Step/1e6; v += r.Step {
+		result = append(result, v)
+	}
+	return result
+}
+
+type sweepSpecification struct {
+	Replicates int    // runs per parameter combination
+	Workers    int    // simulations executed concurrently, defaults to the number of CPUs
+	Output     string // results table, defaults to sweep.csv
+	Parameters map[string]sweepRange
+}
+
+type sweepJob struct {
+	index     int
+	values    []float64
+	replicate int
+	seed      int64
+}
+
+type sweepResult struct {
+	sweepJob
+	summary simulationSummary
+	history []globalStatsStruct
+}
+
+// setParameter assigns a numeric value to the exported mainParametersStruct field with the given name
+func setParameter(parameters *mainParametersStruct, name string, value float64) error {
+	field := reflect.ValueOf(parameters).Elem().FieldByName(name)
+	if !field.IsValid() || !field.CanSet() {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		field.SetInt(int64(math.Round(value)))
+	case reflect.Float64:
+		field.SetFloat(value)
+	default:
+		return fmt.Errorf("parameter %q is not numeric", name)
+	}
+	return nil
+}
+
+// simulatedValue is the value a parameter takes once set: integer parameters are rounded
+func simulatedValue(name string, value float64) float64 {
+	switch reflect.ValueOf(mainParametersStruct{}).FieldByName(name).Kind() {
+	case reflect.Int, reflect.Int64:
+		return math.Round(value)
+	}
+	return value
+}
+
+// cartesianProduct enumerates every combination of the given value lists
+func cartesianProduct(lists [][]float64) [][]float64 {
+	combinations := [][]float64{{}}
+	for _, list := range lists {
+		var next [][]float64
+		for _, combination := range combinations {
+			for _, value := range list {
+				extended := append(append([]float64{}, combination...), value)
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// runJobs executes the simulations in parallel and returns their summaries in job order
+func runJobs(parameters mainParametersStruct, names []string, jobs []sweepJob, workers int) []sweepResult {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]sweepResult, len(jobs))
+	queue := make(chan sweepJob)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				jobParameters := parameters
+				for i, name := range names {
+					checkError("Invalid sweep: ", setParameter(&jobParameters, name, job.values[i]))
+				}
+				jobParameters.Seed = job.seed
+
+				s := newSimulation(jobParameters)
+				s.run()
+				results[job.index] = sweepResult{sweepJob: job, summary: s.summary(), history: s.history}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+func runSweep(fn string, parameters mainParametersStruct) {
+	var specification sweepSpecification
+	readJSON(fn, &specification)
+
+	if len(specification.Parameters) == 0 {
+		fmt.Println("Nothing to sweep over")
+		return
+	}
+	if specification.Replicates <= 0 {
+		specification.Replicates = 1
+	}
+	if specification.Output == "" {
+		specification.Output = "sweep.csv"
+	}
+
+	var names []string
+	for name := range specification.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lists [][]float64
+	for _, name := range names {
+		checkError("Invalid sweep: ", setParameter(&mainParametersStruct{}, name, 0))
+		lists = append(lists, specification.Parameters[name].values())
+	}
+
+	baseSeed := parameters.Seed
+	if baseSeed == 0 {
+		baseSeed = time.Now().UnixNano()
+	}
+
+	var jobs []sweepJob
+	for _, combination := range cartesianProduct(lists) {
+		for replicate := 1; replicate <= specification.Replicates; replicate++ {
+			jobs = append(jobs, sweepJob{
+				index:     len(jobs),
+				values:    combination,
+				replicate: replicate,
+				seed:      baseSeed + int64(len(jobs)),
+			})
+		}
+	}
+
+	fmt.Printf("Sweeping %v parameters: %v runs\n", len(names), len(jobs))
+	results := runJobs(parameters, names, jobs, specification.Workers)
+
+	file, err := os.Create(specification.Output)
+	checkError("Cannot create file", err)
+	defer file.Close()
+
+	sweepLog := csv.NewWriter(file)
+	defer sweepLog.Flush()
+
+	header := append(append([]string{}, names...), "Replicate", "Seed", "Days", "Dead", "Recovered", "Peak ill", "Peak ill day", "Attack rate", "Self-isolated", "Offspring before the peak", "Offspring dispersion")
+	sweepLog.Write(header)
+
+	for _, result := range results {
+		var line []string
+		for _, value := range result.values {
+			line = append(line, fmt.Sprintf("%v", value))
+		}
+		line = append(line,
+			fmt.Sprintf("%v", result.replicate),
+			fmt.Sprintf("%v", result.seed),
+			fmt.Sprintf("%v", result.summary.days),
+			fmt.Sprintf("%v", result.summary.dead),
+			fmt.Sprintf("%v", result.summary.recovered),
+			fmt.Sprintf("%v", result.summary.peakIll),
+			fmt.Sprintf("%v", result.summary.peakIllDay),
+			fmt.Sprintf("%.2f", result.summary.attackRate),
+			fmt.Sprintf("%v", result.summary.selfIsolated),
+			fmt.Sprintf("%.3f", result.summary.offspring.early),
+			fmt.Sprintf("%.3f", result.summary.offspring.dispersion),
+		)
+		sweepLog.Write(line)
+	}
+
+	fmt.Printf("Sweep results written to %v\n", specification.Output)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Treatments are given to the sick who are eligible for them (age, severity of the case, state,
+// days since the symptoms showed up), a course each, as long as the day's supply lasts: every
+// day the sick are served in the order they are listed. A treated citizen's chances to be
+// hospitalized (to be taken under treatment or to ICU) and to die are multiplied, and so is the
+// time they spend in ICU. Treatments are given in the order of the config, a citizen may
+// receive several of them.
+
+const maximumTreatments = 8 // citizens keep the treatments they received as a bit set in a byte
+
+type treatmentSpecification struct {
+	Name            string
+	MinimumAge      int      // eligible from this age on
+	Severities      []string // eligible severity levels, all when omitted
+	States          []State  // eligible states, "ill" when omitted
+	WithinDays      int      // eligible up to this day since the symptoms showed up, 0 for no limit
+	DailySupply     int      // courses available every day, 0 for no limit
+	Hospitalization float64  // multiplies the chance to be hospitalized or taken to ICU, 1 when omitted
+	Mortality       float64  // multiplies the chance to die, 1 when omitted
+	ICUStay         float64  // multiplies the time spent in ICU, 1 when omitted
+}
+
+type treatment struct {
+	treatmentSpecification
+	severities [severityLevels]bool
+	states     [stateCount]bool
+}
+
+func compileTreatments(parameters *mainParametersStruct) ([]treatment, error) {
+	if len(parameters.Treatments) > maximumTreatments {
+		return nil, fmt.Errorf("%v treatments, at most %v supported", len(parameters.Treatments), maximumTreatments)
+	}
+
+	var treatments []treatment
+	for _, specification := range parameters.Treatments {
+		t := treatment{treatmentSpecification: specification}
+		if t.Name == "" {
+			return nil, fmt.Errorf("treatment %v has no name", len(treatments)+1)
+		}
+		for _, multiplier := range []*float64{&t.Hospitalization, &t.Mortality, &t.ICUStay} {
+			if *multiplier < 0 {
+				return nil, fmt.Errorf("treatment %v: negative multiplier", t.Name)
+			}
+			if *multiplier == 0 {
+				*multiplier = 1
+			}
+		}
+		if t.DailySupply < 0 || t.WithinDays < 0 {
+			return nil, fmt.Errorf("treatment %v: negative supply or days", t.Name)
+		}
+
+		for level := range t.severities {
+			t.severities[level] = len(specification.Severities) == 0
+		}
+		for _, name := range specification.Severities {
+			level, err := parseSeverity(name)
+			if err != nil {
+				return nil, fmt.Errorf("treatment %v: %v", t.Name, err)
+			}
+			t.severities[level] = true
+		}
+
+		states := specification.States
+		if len(states) == 0 {
+			states = []State{StateIll}
+		}
+		for _, state := range states {
+			if state >= stateCount || state == StateHealthy || state.settled() {
+				return nil, fmt.Errorf("treatment %v: the %v cannot be treated", t.Name, state)
+			}
+			t.states[state] = true
+		}
+
+		treatments = append(treatments, t)
+	}
+	return treatments, nil
+}
+
+// eligible tells whether the citizen may receive the treatment today
+func (t *treatment) eligible(c citizen) bool {
+	return t.states[c.state] && t.severities[c.sicknessSeverity] && c.age >= t.MinimumAge &&
+		(t.WithinDays == 0 || (c.daysSinceOnset > 0 && c.daysSinceOnset <= t.WithinDays))
+}
+
+// multiplier of the chance of a transition for a treated citizen. Leaving ICU is made less likely
+// by ICUStay, which lengthens the stay when ICU has no dwell time and cancels out when it has one.
+func (t *treatment) multiplier(from, to State) float64 {
+	stay := 1.0
+	if from == StateICU {
+		stay = 1 / t.ICUStay
+	}
+	switch to {
+	case StateUnderTreatment, StateICU:
+		return t.Hospitalization * stay
+	case StateDead:
+		return t.Mortality * stay
+	}
+	return stay
+}
+
+// allocateTreatments makes room for the treatments of the run the population hasn't got yet
+func (s *simulation) allocateTreatments() {
+	if len(s.treatments) == 0 || s.population.treatments != nil {
+		return
+	}
+	s.population.treatments = make([]uint8, s.population.size())
+	s.population.onset = make([]uint16, s.population.size())
+}
+
+func (globalStats *globalStatsStruct) totalTreatmentCourses() (total int) {
+	for _, courses := range globalStats.treatmentCourses {
+		total += courses
+	}
+	return
+}
+
+// deliverTreatments gives the day's courses to the eligible sick
+func (s *simulation) deliverTreatments() {
+	if len(s.treatments) == 0 {
+		return
+	}
+	var delivered [maximumTreatments]int
+	for _, index := range s.arrayOfSick {
+		c := s.population.citizen(index)
+		for i := range s.treatments {
+			t := &s.treatments[i]
+			if c.treatments&(1<<i) != 0 || (t.DailySupply > 0 && delivered[i] >= t.DailySupply) || !t.eligible(c) {
+				continue
+			}
+			c.treatments |= 1 << i
+			s.population.treatments[index] = c.treatments
+			delivered[i]++
+			s.globalStats.treatmentCourses[i]++
+		}
+	}
+}
+
+// icuStay is the dwell time in ICU of a citizen, given the treatments they received
+func (s *simulation) icuStay(c citizen, dwell int) int {
+	stay := float64(dwell)
+	for i := range s.treatments {
+		if c.treatments&(1<<i) != 0 {
+			stay *= s.treatments[i].ICUStay
+		}
+	}
+	return int(math.Max(1, math.Round(stay)))
+}
+
+// treatmentOutcomes are the courses given and what became of the treated citizens
+type treatmentOutcomes struct {
+	name      string
+	courses   int
+	dead      int
+	recovered int
+	sick      int
+}
+
+func (s *simulation) treatmentOutcomes() []treatmentOutcomes {
+	outcomes := make([]treatmentOutcomes, len(s.treatments))
+	for i := range s.treatments {
+		outcomes[i].name = s.treatments[i].Name
+		outcomes[i].courses = s.globalStats.treatmentCourses[i]
+	}
+	for index, treatments := range s.population.treatments {
+		for i := range outcomes {
+			if treatments&(1<<i) == 0 {
+				continue
+			}
+			switch s.population.state[index] {
+			case StateDead:
+				outcomes[i].dead++
+			case StateRecovered:
+				outcomes[i].recovered++
+			case StateVacant:
+			default:
+				outcomes[i].sick++
+			}
+		}
+	}
+	return outcomes
+}
+
+func (o treatmentOutcomes) String() string {
+	fatality := 0.0
+	if o.dead+o.recovered > 0 {
+		fatality = float64(o.dead) * 100 / float64(o.dead+o.recovered)
+	}
+	return fmt.Sprintf("%-20v %10v %10v %10v %10v %14.2f", o.name, o.courses, o.dead, o.recovered, o.sick, fatality)
+}
+
+func (s *simulation) logTreatments() {
+	if len(s.treatments) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("%-20v %10v %10v %10v %10v %14v", "Treatment", "Courses", "Dead", "Recovered", "Still sick", "Fatality, %")}
+	for _, outcome := range s.treatmentOutcomes() {
+		lines = append(lines, outcome.String())
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTreatmentEligibility(t *testing.T) {
+	s := newSimulation(testParameters(t, "hospital.json", `{}`))
+	antiviral, steroids := &s.treatments[0], &s.treatments[1]
+
+	for _, test := range []struct {
+		name     string
+		t        *treatment
+		c        citizen
+		eligible bool
+	}{
+		{"antiviral, old and ill", antiviral, citizen{state: StateIll, age: 70, daysSinceOnset: 1}, true},
+		{"antiviral, last day", antiviral, citizen{state: StateIll, age: 70, daysSinceOnset: 5}, true},
+		{"antiviral, too late", antiviral, citizen{state: StateIll, age: 70, daysSinceOnset: 6}, false},
+		{"antiviral, too young", antiviral, citizen{state: StateIll, age: 50, daysSinceOnset: 1}, false},
+		{"antiviral, hospitalized", antiviral, citizen{state: StateUnderTreatment, age: 70, daysSinceOnset: 1}, false},
+		{"steroids, ill", steroids, citizen{state: StateIll, age: 70}, false},
+		{"steroids, hospitalized", steroids, citizen{state: StateUnderTreatment, age: 20}, true},
+		{"steroids, in ICU", steroids, citizen{state: StateICU, age: 20, daysSinceOnset: 30}, true},
+	} {
+		if eligible := test.t.eligible(test.c); eligible != test.eligible {
+			t.Errorf("%v: eligible %v, %v expected", test.name, eligible, test.eligible)
+		}
+	}
+
+	for name, overrides := range map[string]string{
+		"no name":             `{"Treatments": [{"Mortality": 0.5}]}`,
+		"negative multiplier": `{"Treatments": [{"Name": "A", "Mortality": -0.5}]}`,
+		"negative supply":     `{"Treatments": [{"Name": "A", "DailySupply": -1}]}`,
+		"unknown severity":    `{"Treatments": [{"Name": "A", "Severities": ["Moderate"]}]}`,
+		"settled state":       `{"Treatments": [{"Name": "A", "States": ["recovered"]}]}`,
+	} {
+		p := testParameters(t, "config.json", overrides)
+		if _, err := compileTreatments(&p); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+}
+
+func TestDeliverTreatments(t *testing.T) {
+	s := newSimulation(testParameters(t, "hospital.json", `{}`))
+
+	// 30 old and 10 young ill citizens, then 5 in hospital
+	s.arrayOfSick = nil
+	for index := personIndex(0); index < 45; index++ {
+		c := s.population.citizen(index)
+		c.state, c.age, c.daysSinceOnset, c.treatments = StateIll, 70, 1, 0
+		if index >= 30 {
+			c.age = 30
+		}
+		if index >= 40 {
+			c.state = StateUnderTreatment
+		}
+		s.population.setCitizen(c)
+		s.arrayOfSick = append(s.arrayOfSick, index)
+	}
+
+	// the antiviral runs out after the first 20 of the old, steroids don't
+	s.deliverTreatments()
+	if courses := s.globalStats.treatmentCourses; courses[0] != 20 || courses[1] != 5 {
+		t.Fatalf("%v antiviral and %v steroid courses, 20 and 5 expected", courses[0], courses[1])
+	}
+	for index := personIndex(0); index < 45; index++ {
+		expected := uint8(0)
+		switch {
+		case index < 20:
+			expected = 1
+		case index >= 40:
+			expected = 2
+		}
+		if treatments := s.population.treatmentsOf(index); treatments != expected {
+			t.Errorf("citizen %v received %b, %b expected", index, treatments, expected)
+		}
+	}
+
+	// the next day the rest of the old get theirs, nobody gets a second course
+	s.deliverTreatments()
+	if courses := s.globalStats.treatmentCourses; courses[0] != 30 || courses[1] != 5 {
+		t.Errorf("%v antiviral and %v steroid courses on the second day, 30 and 5 expected", courses[0], courses[1])
+	}
+}
+
+func TestTreatmentEffects(t *testing.T) {
+	s := newSimulation(testParameters(t, "hospital.json", `{}`))
+
+	// the antiviral halves the chance of admission, steroids make death less likely in ICU
+	for _, test := range []struct {
+		from, to   State
+		treatments uint8
+		multiplier float64
+	}{
+		{StateIll, StateUnderTreatment, 1, 0.5},
+		{StateIll, StateRecovered, 1, 1},
+		{StateICU, StateDead, 2, 0.7 / 0.8},
+		{StateICU, StateRecovered, 2, 1 / 0.8},
+	} {
+		for i := range s.transitionTable[test.from] {
+			rule := &s.transitionTable[test.from][i]
+			if rule.to != test.to {
+				continue
+			}
+			c := citizen{state: test.from, age: 70, sicknessSeverity: severitySevere}
+			treated := c
+			treated.treatments = test.treatments
+			without, with := rule.weight(s, c), rule.weight(s, treated)
+			if diff := with - without*test.multiplier; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("%v to %v: %v treated, %v untreated", test.from, test.to, with, without)
+			}
+		}
+	}
+
+	// steroids shorten the stay in ICU, never below a day
+	for dwell, expected := range map[int]int{10: 8, 5: 4, 1: 1} {
+		if stay := s.icuStay(citizen{treatments: 2}, dwell); stay != expected {
+			t.Errorf("%v days in ICU with steroids, %v expected for %v", stay, expected, dwell)
+		}
+		if stay := s.icuStay(citizen{treatments: 1}, dwell); stay != dwell {
+			t.Errorf("%v days in ICU with the antiviral, %v expected", stay, dwell)
+		}
+	}
+}
+
+func TestTreatmentAvertsDeaths(t *testing.T) {
+	deaths := func(treatments []treatmentSpecification) int {
+		p := testParameters(t, "hospital.json", `{}`)
+		p.Seed, p.Treatments = 1, treatments
+		s, err := runChecked(p, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.globalStats.totalDead
+	}
+	untreated := deaths(nil)
+	treated := deaths([]treatmentSpecification{{Name: "Cure", States: []State{StateIll, StateUnderTreatment, StateICU}, Mortality: 0.2}})
+	if untreated == 0 || treated >= untreated/2 {
+		t.Errorf("%v dead with the treatment, %v without", treated, untreated)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// transitions are the changes found while the population is read-only, waiting to be applied
+type transitions struct {
+	infections   []personIndex // healthy citizens caught by someone, duplicates possible
+	infectors    []personIndex // who caught each of them
+	progressions []citizen     // sick citizens in their new condition
+	delta        globalStatsStruct
+}
+
+// add accumulates the counters of a delta
+func (globalStats *globalStatsStruct) add(delta globalStatsStruct) {
+	globalStats.totalInfected += delta.totalInfected
+	globalStats.totalAsymptomatic += delta.totalAsymptomatic
+	globalStats.totalRecovered += delta.totalRecovered
+	globalStats.totalIll += delta.totalIll
+	globalStats.totalEverIll += delta.totalEverIll
+	globalStats.totalDead += delta.totalDead
+	globalStats.totalIntact += delta.totalIntact
+	globalStats.totalSelfIsolated += delta.totalSelfIsolated
+	globalStats.totalHospitalized += delta.totalHospitalized
+	globalStats.totalICU += delta.totalICU
+	globalStats.totalVacant += delta.totalVacant
+	globalStats.totalBirths += delta.totalBirths
+	globalStats.totalNaturalDeaths += delta.totalNaturalDeaths
+	globalStats.totalImported += delta.totalImported
+	globalStats.totalLocal += delta.totalLocal
+	for b := range globalStats.averted {
+		globalStats.averted[b] += delta.averted[b]
+	}
+}
+
+// infectiousness is the citizen's chance to pass the disease on to a contact, relative to TransitionRate
+func (s *simulation) infectiousness(c citizen) float64 {
+	relative := c.infectiousness
+	if c.state == StateInfected {
+		relative *= s.parameters.AsymptomaticInfectiousness
+	}
+	if curve := s.parameters.InfectiousnessCurve; len(curve) > 0 && c.daysInfected > 0 {
+		day := c.daysInfected
+		if day > len(curve) {
+			day = len(curve)
+		}
+		relative *= curve[day-1]
+	}
+	return relative
+}
+
+// collectTransitions plays the day for the given sick citizens without touching the population
+func (s *simulation) collectTransitions(current *populationType, sick []personIndex, r1 *rand.Rand) (result transitions) {
+	seasonal := s.transmissionMultiplier(s.globalStats.daysCount)
+	for _, element := range sick {
+		//1. take a person
+		person := current.citizen(element)
+
+		if enableDebugMessages {
+			fmt.Printf("Person [%v] already %v days in state %v\n", person.personID, person.daysInState, person.state)
+		}
+
+		// if a person is either recovered for good or dead, do nothing
+		if !s.followed(person.state) {
+			continue
+		}
+
+		//2. get neighbours
+		// an isolated citizen who keeps to the rules meets no one today
+		if person.state.infectious() && !(person.selfIsolated && r1.Intn(100) < s.isolationStrictness(person.daysIsolated)) {
+			transitionRate := float64(s.parameters.TransitionRate) * seasonal * s.infectiousness(person)
+			for _, contactElement := range s.getContacted(person, s.parameters.MaximumTravelRange, s.parameters.MaximumContactsPerDay, r1) {
+				if current.selfIsolated[contactElement] && (r1.Intn(100) < s.isolationStrictness(current.daysIsolated(contactElement))) {
+					continue
+				}
+
+				//3. calculate a chance to infect each of them, recovered and dead stay intact
+				if current.stateOf(contactElement) == StateHealthy && r1.Float64()*100 < transitionRate {
+					if behaviour := s.protected(current, person, contactElement, r1); behaviour >= 0 {
+						result.delta.averted[behaviour]++
+						continue
+					}
+					result.infections = append(result.infections, contactElement)
+					result.infectors = append(result.infectors, element)
+
+					if enableDebugMessages {
+						fmt.Println("Contacted person", current.id(contactElement), " gets infected")
+					}
+				}
+			}
+		}
+
+		//4. move on according to the transition table
+		updated := person
+		if rule := s.nextTransition(person, r1); rule != nil {
+			s.enterState(&updated, rule.to, r1, &result.delta)
+
+			if enableDebugMessages {
+				fmt.Printf("Person [%v] becomes %v after %v days in state %v\n", person.personID, rule.to, person.daysInState, person.state)
+			}
+		}
+
+		result.progressions = append(result.progressions, updated)
+	}
+	return
+}
+
+// infect makes a citizen catch the disease today, drawing what the course of their infection depends on
+func (s *simulation) infect(index personIndex, state State) {
+	severity := s.drawSeverity(s.population.citizen(index), s.r1)
+	dwell := s.dwell(state, s.r1)
+	infectiousness := 1.0
+	if k := s.parameters.InfectiousnessDispersion; k > 0 {
+		infectiousness = sampleGamma(s.r1, k) / k
+	}
+	s.population.infect(index, state, severity, dwell, infectiousness)
+}
+
+// applyTransitions writes the collected changes into the population, in the given order:
+// a citizen caught from several sides is only infected once
+func (s *simulation) applyTransitions(collected []transitions) {
+	var arrayOfSick, newlyInfected []personIndex
+
+	for _, result := range collected {
+		s.globalStats.add(result.delta)
+
+		for _, updated := range result.progressions {
+			if updated.selfIsolated && !s.population.selfIsolated[s.population.index(updated.personID)] {
+				s.isolated = append(s.isolated, s.population.index(updated.personID))
+			}
+			s.population.setCitizen(updated)
+			if s.followed(updated.state) {
+				arrayOfSick = append(arrayOfSick, s.population.index(updated.personID))
+			}
+		}
+	}
+
+	for _, result := range collected {
+		for i, index := range result.infections {
+			if s.population.stateOf(index) != StateHealthy {
+				continue
+			}
+			s.infect(index, StateSusceptible)
+			s.offspring[result.infectors[i]]++
+			s.globalStats.totalInfected++
+			s.globalStats.totalIntact--
+			s.globalStats.totalLocal++
+			newlyInfected = append(newlyInfected, index)
+		}
+	}
+
+	s.arrayOfSick = append(arrayOfSick, newlyInfected...)
+}